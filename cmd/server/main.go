@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rongwang/COMP90018-server/internal/api"
 	"github.com/rongwang/COMP90018-server/internal/config"
+	"github.com/rongwang/COMP90018-server/internal/keyset"
+	"github.com/rongwang/COMP90018-server/internal/mailer"
+	"github.com/rongwang/COMP90018-server/internal/password"
 	"github.com/rongwang/COMP90018-server/internal/repository"
 	"github.com/rongwang/COMP90018-server/internal/service"
 )
@@ -26,8 +30,29 @@ func main() {
 	// Create repository
 	repo := repository.NewPostgresRepository(db)
 
+	// Create mailer
+	m, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	// Load JWT signing keys
+	keys, err := keyset.New(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// Set up password hashing
+	passwords, err := password.New(cfg.Auth.Password)
+	if err != nil {
+		log.Fatalf("Failed to set up password hashing: %v", err)
+	}
+
 	// Create service
-	svc := service.NewDefaultService(repo, cfg.Auth.JWTSecret)
+	svc := service.NewDefaultService(repo, cfg, m, keys, passwords)
+
+	// Permanently delete ledgers left in the trash past the retention period
+	go service.RunLedgerPurger(context.Background(), svc, cfg.Ledger.PurgeInterval)
 
 	// Create API handler
 	handler := api.NewHandler(svc)
@@ -35,11 +60,10 @@ func main() {
 	// Set up Gin router
 	router := gin.Default()
 
-	// Add middleware for JWT secret
-	router.Use(func(c *gin.Context) {
-		c.Set("jwtSecret", []byte(cfg.Auth.JWTSecret))
-		c.Next()
-	})
+	// Only believe X-Forwarded-For from our own proxies, so clients can't pick their IP
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Set up routes
 	handler.SetupRoutes(router)
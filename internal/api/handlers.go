@@ -1,11 +1,15 @@
 package api
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/password"
 	"github.com/rongwang/COMP90018-server/internal/service"
 )
 
@@ -23,23 +27,95 @@ func NewHandler(service service.Service) *Handler {
 
 // SetupRoutes sets up all the routes for the API
 func (h *Handler) SetupRoutes(r *gin.Engine) {
+	// Public signing keys for services that verify our tokens
+	r.GET("/.well-known/jwks.json", h.JWKS)
+
+	// ISO 4217 currencies ledgers can be kept in
+	r.GET("/api/currencies", h.ListCurrencies)
+
 	// Group for authentication endpoints
 	auth := r.Group("/api/auth")
 	{
 		auth.POST("/signup", h.SignUp)
 		auth.POST("/login", h.Login)
+		auth.POST("/login/mfa", h.LoginMFA)
+		auth.POST("/refresh", h.RefreshToken)
+		auth.POST("/password/forgot", h.ForgotPassword)
+		auth.POST("/password/reset", h.ResetPassword)
+		auth.POST("/verify", h.VerifyEmail)
+		auth.POST("/verify/resend", h.ResendVerification)
+		auth.POST("/email/confirm", h.ConfirmEmailChange)
+		auth.POST("/magic-link", h.RequestMagicLink)
+		auth.POST("/magic-link/consume", h.ConsumeMagicLink)
+		auth.POST("/webauthn/login/start", h.StartWebAuthnLogin)
+		auth.POST("/webauthn/login/finish", h.FinishWebAuthnLogin)
+		auth.POST("/oidc/:provider/start", h.StartOIDCLogin)
+		auth.POST("/oidc/:provider/callback", h.CompleteOIDCLogin)
+	}
+
+	// Group for authentication endpoints that act on the current token
+	session := r.Group("/api/auth")
+	session.Use(AuthMiddleware(h.service), RequireSession())
+	{
+		session.POST("/logout", h.Logout)
+		session.POST("/logout-all", h.LogoutAll)
+		session.POST("/mfa/totp/enroll", h.EnrollTOTP)
+		session.POST("/mfa/totp/confirm", h.ConfirmTOTP)
+		session.POST("/mfa/totp/disable", h.DisableTOTP)
+		session.POST("/tokens", h.CreatePersonalAccessToken)
+		session.GET("/tokens", h.ListPersonalAccessTokens)
+		session.DELETE("/tokens/:tokenId", h.RevokePersonalAccessToken)
+		session.POST("/webauthn/register/start", h.StartWebAuthnRegistration)
+		session.POST("/webauthn/register/finish", h.FinishWebAuthnRegistration)
+		session.GET("/webauthn/credentials", h.ListWebAuthnCredentials)
+		session.DELETE("/webauthn/credentials/:credentialId", h.DeleteWebAuthnCredential)
+	}
+
+	// Group for the signed-in user's account
+	me := r.Group("/api/users/me")
+	me.Use(AuthMiddleware(h.service), RequireSession())
+	{
+		me.GET("", h.GetProfile)
+		me.PATCH("", h.UpdateProfile)
+		me.POST("/password", h.ChangePassword)
+		me.DELETE("", h.DeleteAccount)
+		me.POST("/email", h.RequestEmailChange)
+		me.GET("/export", h.ExportUserData)
+		me.GET("/sessions", h.ListSessions)
+		me.DELETE("/sessions/:sessionId", h.RevokeSession)
+	}
+
+	// Group for ledger template endpoints (requires authentication)
+	templates := r.Group("/api/ledger-templates")
+	templates.Use(AuthMiddleware(h.service))
+	{
+		templates.GET("", h.ListLedgerTemplates)
+		templates.POST("", h.SaveLedgerTemplate)
+		templates.DELETE("/:templateId", h.DeleteLedgerTemplate)
 	}
 
 	// Group for ledger endpoints (requires authentication)
 	ledgers := r.Group("/api/ledgers")
-	ledgers.Use(AuthMiddleware())
+	ledgers.Use(AuthMiddleware(h.service))
 	{
 		ledgers.POST("", h.CreateLedger)
+		ledgers.GET("", h.ListLedgers)
+		ledgers.GET("/trash", h.ListTrashedLedgers)
+		ledgers.GET("/:ledgerId", h.GetLedger)
+		ledgers.PATCH("/:ledgerId", h.UpdateLedger)
+		ledgers.GET("/:ledgerId/events", h.GetLedgerEvents)
+		ledgers.POST("/:ledgerId/fork", h.ForkLedger)
 		ledgers.DELETE("/:ledgerId", h.DeleteLedger)
+		ledgers.POST("/:ledgerId/restore", h.RestoreLedger)
+		ledgers.POST("/:ledgerId/archive", h.ArchiveLedger)
+		ledgers.POST("/:ledgerId/unarchive", h.UnarchiveLedger)
 		ledgers.POST("/:ledgerId/changes", h.SubmitLedgerChange)
 		ledgers.GET("/:ledgerId/changes", h.GetLedgerChanges)
 		ledgers.GET("/:ledgerId/sequence", h.GetLatestSequenceNumber)
 		ledgers.POST("/:ledgerId/users", h.AddUserToLedger)
+		ledgers.POST("/:ledgerId/transfer", h.ProposeLedgerTransfer)
+		ledgers.POST("/:ledgerId/transfer/accept", h.AcceptLedgerTransfer)
+		ledgers.DELETE("/:ledgerId/transfer", h.CancelLedgerTransfer)
 	}
 }
 
@@ -57,6 +133,10 @@ func (h *Handler) SignUp(c *gin.Context) {
 
 	res, err := h.service.SignUp(c.Request.Context(), req)
 	if err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
+
 		if err.Error() == "user with this email already exists" {
 			c.JSON(http.StatusConflict, models.ErrorResponse{
 				Status:  "error",
@@ -88,8 +168,15 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
 	res, err := h.service.Login(c.Request.Context(), req)
 	if err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+
 		if err.Error() == "invalid email or password" {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
@@ -99,6 +186,15 @@ func (h *Handler) Login(c *gin.Context) {
 			return
 		}
 
+		if err.Error() == "email address not verified" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "EMAIL_NOT_VERIFIED",
+				Message: err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
@@ -110,9 +206,8 @@ func (h *Handler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
-// Ledger handlers
-func (h *Handler) CreateLedger(c *gin.Context) {
-	var req models.CreateLedgerRequest
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
@@ -122,81 +217,182 @@ func (h *Handler) CreateLedger(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userID := c.GetString("userId")
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
 
-	res, err := h.service.CreateLedger(c.Request.Context(), userID, req)
+	res, err := h.service.LoginMFA(c.Request.Context(), req)
 	if err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+
+		if err.Error() == "invalid or expired mfa token" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Code:    "UNAUTHORIZED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid two-factor code" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_MFA_CODE",
+				Message: err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
-			Message: "Failed to create ledger",
+			Message: "Failed to login",
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, res)
+	c.JSON(http.StatusOK, res)
 }
 
-func (h *Handler) DeleteLedger(c *gin.Context) {
-	ledgerID := c.Param("ledgerId")
-	if ledgerID == "" {
+// respondLoginThrottled writes a 429 with a Retry-After header if err is a lockout
+func respondLoginThrottled(c *gin.Context, err error) bool {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Status:  "error",
+		Code:    "TOO_MANY_ATTEMPTS",
+		Message: err.Error(),
+	})
+	return true
+}
+
+// respondPasswordPolicy answers with the rules a rejected password failed.
+// It returns false if err is not a password policy error.
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, models.PasswordPolicyErrorResponse{
+		Status:     "error",
+		Code:       "WEAK_PASSWORD",
+		Message:    err.Error(),
+		Violations: policyErr.Violations,
+	})
+	return true
+}
+
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Code:    "BAD_REQUEST",
-			Message: "Ledger ID is required",
+			Message: "Invalid request parameters",
 		})
 		return
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userID := c.GetString("userId")
+	req.ClientIP = c.ClientIP()
 
-	if err := h.service.DeleteLedger(c.Request.Context(), userID, ledgerID); err != nil {
-		if err.Error() == "ledger not found" {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
+	res, err := h.service.RefreshToken(c.Request.Context(), req)
+	if err != nil {
+		if err.Error() == "invalid refresh token" || err.Error() == "refresh token reuse detected" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
-				Code:    "NOT_FOUND",
+				Code:    "UNAUTHORIZED",
 				Message: err.Error(),
 			})
 			return
 		}
 
-		if err.Error() == "you don't have permission to delete this ledger" {
-			c.JSON(http.StatusForbidden, models.ErrorResponse{
-				Status:  "error",
-				Code:    "FORBIDDEN",
-				Message: err.Error(),
-			})
-			return
-		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to refresh token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	// Get user ID and token details from context (set by auth middleware)
+	userID := c.GetString("userId")
+	tokenID := c.GetString("tokenId")
+	sessionID := c.GetString("sessionId")
+	expiresAt := c.GetTime("tokenExpiresAt")
 
+	if err := h.service.Logout(c.Request.Context(), userID, tokenID, sessionID, expiresAt); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
-			Message: "Failed to delete ledger",
+			Message: "Failed to logout",
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Ledger deleted successfully",
+		"message": "Logged out successfully",
 	})
 }
 
-func (h *Handler) SubmitLedgerChange(c *gin.Context) {
-	ledgerID := c.Param("ledgerId")
-	if ledgerID == "" {
+func (h *Handler) LogoutAll(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.LogoutAll(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to logout from all sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Logged out from all sessions successfully",
+	})
+}
+
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Code:    "BAD_REQUEST",
-			Message: "Ledger ID is required",
+			Message: "Invalid request parameters",
 		})
 		return
 	}
 
-	var req models.LedgerChangeRequest
+	if err := h.service.ForgotPassword(c.Request.Context(), req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to request password reset",
+		})
+		return
+	}
+
+	// The response is the same whether or not the account exists
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
@@ -206,25 +402,51 @@ func (h *Handler) SubmitLedgerChange(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userID := c.GetString("userId")
+	if err := h.service.ResetPassword(c.Request.Context(), req); err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
 
-	res, err := h.service.SubmitLedgerChange(c.Request.Context(), userID, ledgerID, req)
-	if err != nil {
-		if err.Error() == "you don't have write permission for this ledger" {
-			c.JSON(http.StatusForbidden, models.ErrorResponse{
+		if err.Error() == "invalid or expired reset token" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Status:  "error",
-				Code:    "FORBIDDEN",
+				Code:    "INVALID_TOKEN",
 				Message: err.Error(),
 			})
 			return
 		}
 
-		if err.Error() == "sequence number conflict" {
-			c.JSON(http.StatusConflict, models.ErrorResponse{
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password reset successfully",
+	})
+}
+
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	if err := h.service.VerifyEmail(c.Request.Context(), req); err != nil {
+		if err.Error() == "invalid or expired verification token" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Status:  "error",
-				Code:    "CONFLICT",
-				Message: "Sequence number conflict. Please fetch latest changes and retry.",
+				Code:    "INVALID_TOKEN",
+				Message: err.Error(),
 			})
 			return
 		}
@@ -232,70 +454,95 @@ func (h *Handler) SubmitLedgerChange(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
-			Message: "Failed to submit ledger change",
+			Message: "Failed to verify email",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, res)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Email verified successfully",
+	})
 }
 
-func (h *Handler) GetLedgerChanges(c *gin.Context) {
-	ledgerID := c.Param("ledgerId")
-	if ledgerID == "" {
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Code:    "BAD_REQUEST",
-			Message: "Ledger ID is required",
+			Message: "Invalid request parameters",
 		})
 		return
 	}
 
-	// Get sequence range from query parameters
-	fromSeqStr := c.Query("fromSequence")
-	if fromSeqStr == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+	if err := h.service.ResendVerification(c.Request.Context(), req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
-			Code:    "BAD_REQUEST",
-			Message: "fromSequence parameter is required",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to send verification email",
 		})
 		return
 	}
 
-	fromSeq, err := strconv.ParseInt(fromSeqStr, 10, 64)
-	if err != nil {
+	// The response is the same whether or not the account exists
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "If an unverified account exists for this email, a verification link has been sent",
+	})
+}
+
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var req models.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
 			Code:    "BAD_REQUEST",
-			Message: "Invalid fromSequence parameter",
+			Message: "Invalid request parameters",
 		})
 		return
 	}
 
-	// toSequence is optional
-	var toSeq int64 = 0
-	toSeqStr := c.Query("toSequence")
-	if toSeqStr != "" {
-		toSeq, err = strconv.ParseInt(toSeqStr, 10, 64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, models.ErrorResponse{
-				Status:  "error",
-				Code:    "BAD_REQUEST",
-				Message: "Invalid toSequence parameter",
-			})
+	if err := h.service.RequestMagicLink(c.Request.Context(), req); err != nil {
+		if respondLoginThrottled(c, err) {
 			return
 		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to send sign-in link",
+		})
+		return
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userID := c.GetString("userId")
+	// The response is the same whether or not the account exists
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "If an account exists for this email, a sign-in link has been sent",
+	})
+}
 
-	res, err := h.service.GetLedgerChanges(c.Request.Context(), userID, ledgerID, fromSeq, toSeq)
+func (h *Handler) ConsumeMagicLink(c *gin.Context) {
+	var req models.ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
+	res, err := h.service.ConsumeMagicLink(c.Request.Context(), req)
 	if err != nil {
-		if err.Error() == "you don't have access to this ledger" {
-			c.JSON(http.StatusForbidden, models.ErrorResponse{
+		if err.Error() == "invalid or expired sign-in link" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
 				Status:  "error",
-				Code:    "FORBIDDEN",
+				Code:    "INVALID_TOKEN",
 				Message: err.Error(),
 			})
 			return
@@ -304,7 +551,7 @@ func (h *Handler) GetLedgerChanges(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
-			Message: "Failed to get ledger changes",
+			Message: "Failed to sign in",
 		})
 		return
 	}
@@ -312,18 +559,21 @@ func (h *Handler) GetLedgerChanges(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
-func (h *Handler) AddUserToLedger(c *gin.Context) {
-	ledgerID := c.Param("ledgerId")
-	if ledgerID == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Status:  "error",
-			Code:    "BAD_REQUEST",
-			Message: "Ledger ID is required",
-		})
-		return
-	}
+// JWKS publishes the public keys that verify our access tokens
+func (h *Handler) JWKS(c *gin.Context) {
+	// Clients may cache the key set; rotations keep the old key published for a while
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.service.JWKS())
+}
 
-	var req models.AddUserToLedgerRequest
+// ListCurrencies returns the currencies ledgers can be kept in, with their minor units and symbols
+func (h *Handler) ListCurrencies(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListCurrencies())
+}
+
+// Personal access token handlers
+func (h *Handler) CreatePersonalAccessToken(c *gin.Context) {
+	var req models.CreatePersonalAccessTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Status:  "error",
@@ -336,9 +586,9 @@ func (h *Handler) AddUserToLedger(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID := c.GetString("userId")
 
-	res, err := h.service.AddUserToLedger(c.Request.Context(), userID, ledgerID, req)
+	res, err := h.service.CreatePersonalAccessToken(c.Request.Context(), userID, req)
 	if err != nil {
-		if err.Error() == "you don't have permission to add users to this ledger" {
+		if err.Error() == "you don't have the requested access to every ledger" {
 			c.JSON(http.StatusForbidden, models.ErrorResponse{
 				Status:  "error",
 				Code:    "FORBIDDEN",
@@ -347,10 +597,1653 @@ func (h *Handler) AddUserToLedger(c *gin.Context) {
 			return
 		}
 
-		if err.Error() == "user not found" {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Status:  "error",
-				Code:    "NOT_FOUND",
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to create token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *Handler) ListPersonalAccessTokens(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ListPersonalAccessTokens(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) RevokePersonalAccessToken(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	err := h.service.RevokePersonalAccessToken(c.Request.Context(), userID, c.Param("tokenId"))
+	if err != nil {
+		if err.Error() == "token not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to revoke token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Token revoked successfully",
+	})
+}
+
+// Passkey handlers
+func (h *Handler) StartWebAuthnRegistration(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.StartWebAuthnRegistration(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to start passkey registration",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) FinishWebAuthnRegistration(c *gin.Context) {
+	var req models.FinishWebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.FinishWebAuthnRegistration(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "invalid or expired passkey challenge" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TOKEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid passkey registration" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "passkey already registered" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to register passkey",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *Handler) StartWebAuthnLogin(c *gin.Context) {
+	res, err := h.service.StartWebAuthnLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to start passkey login",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) FinishWebAuthnLogin(c *gin.Context) {
+	var req models.FinishWebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
+	res, err := h.service.FinishWebAuthnLogin(c.Request.Context(), req)
+	if err != nil {
+		if err.Error() == "invalid or expired passkey challenge" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TOKEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid passkey" || err.Error() == "passkey sign count did not increase" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Code:    "UNAUTHORIZED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "email address not verified" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "EMAIL_NOT_VERIFIED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to login",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ListWebAuthnCredentials(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ListWebAuthnCredentials(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list passkeys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) DeleteWebAuthnCredential(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	err := h.service.DeleteWebAuthnCredential(c.Request.Context(), userID, c.Param("credentialId"))
+	if err != nil {
+		if err.Error() == "passkey not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to delete passkey",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Passkey deleted successfully",
+	})
+}
+
+// Profile handlers
+func (h *Handler) GetProfile(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.GetProfile(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to get profile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.UpdateProfile(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to update profile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+
+	// Get user ID and session from context (set by auth middleware)
+	userID := c.GetString("userId")
+	sessionID := c.GetString("sessionId")
+
+	if err := h.service.ChangePassword(c.Request.Context(), userID, sessionID, req); err != nil {
+		if respondLoginThrottled(c, err) || respondPasswordPolicy(c, err) {
+			return
+		}
+
+		if err.Error() == "current password is incorrect" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to change password",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password changed successfully",
+	})
+}
+
+func (h *Handler) RequestEmailChange(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.RequestEmailChange(c.Request.Context(), userID, req); err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+
+		if err.Error() == "current password is incorrect" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "email already in use" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to change email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Confirmation email sent to the new address",
+	})
+}
+
+func (h *Handler) ConfirmEmailChange(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	if err := h.service.ConfirmEmailChange(c.Request.Context(), req); err != nil {
+		if err.Error() == "invalid or expired email change token" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TOKEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "email already in use" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to change email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Email changed successfully",
+	})
+}
+
+func (h *Handler) ExportUserData(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ExportUserData(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to export data",
+		})
+		return
+	}
+
+	// Browsers save the bundle instead of displaying it
+	c.Header("Content-Disposition", `attachment; filename="account-export.json"`)
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.DeleteAccount(c.Request.Context(), userID, req); err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+
+		if err.Error() == "current password is incorrect" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to delete account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Account deleted successfully",
+	})
+}
+
+// Session handlers
+func (h *Handler) ListSessions(c *gin.Context) {
+	// Get user ID and session from context (set by auth middleware)
+	userID := c.GetString("userId")
+	sessionID := c.GetString("sessionId")
+
+	res, err := h.service.ListSessions(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	err := h.service.RevokeSession(c.Request.Context(), userID, c.Param("sessionId"))
+	if err != nil {
+		if err.Error() == "session not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to revoke session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Session revoked successfully",
+	})
+}
+
+// Social login handlers
+func (h *Handler) StartOIDCLogin(c *gin.Context) {
+	res, err := h.service.StartOIDCLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if err.Error() == "unknown identity provider" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to start login",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) CompleteOIDCLogin(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
+	res, err := h.service.CompleteOIDCLogin(c.Request.Context(), c.Param("provider"), req)
+	if err != nil {
+		if err.Error() == "unknown identity provider" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid or expired login state" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_STATE",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "identity provider rejected the login" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Code:    "UNAUTHORIZED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "identity provider did not return a verified email" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "EMAIL_NOT_VERIFIED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "an account with this email exists but is not verified" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "ACCOUNT_EXISTS",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to login",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Two-factor authentication handlers
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.EnrollTOTP(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "two-factor authentication is already enabled" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to start two-factor enrolment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var req models.ConfirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ConfirmTOTP(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "two-factor enrolment not started" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "two-factor authentication is already enabled" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid two-factor code" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_MFA_CODE",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to confirm two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	var req models.DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.DisableTOTP(c.Request.Context(), userID, req); err != nil {
+		if err.Error() == "invalid password" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Status:  "error",
+				Code:    "UNAUTHORIZED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "two-factor authentication is not enabled" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "invalid two-factor code" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_MFA_CODE",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// Ledger handlers
+func (h *Handler) CreateLedger(c *gin.Context) {
+	var req models.CreateLedgerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.CreateLedger(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot create ledgers" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "template not found" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TEMPLATE",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "currency is required" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "unsupported currency" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_CURRENCY",
+				Message: "Currency must be an ISO 4217 code, such as USD",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to create ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *Handler) ListLedgers(c *gin.Context) {
+	var req models.ListLedgersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ListLedgers(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "invalid cursor" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_CURSOR",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list ledgers",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.GetLedger(c.Request.Context(), userID, ledgerID)
+	if err != nil {
+		if err.Error() == "you don't have access to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to get ledger",
+		})
+		return
+	}
+
+	c.Header("ETag", res.Ledger.ETag())
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) UpdateLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	var req models.UpdateLedgerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+	req.IfMatch = c.GetHeader("If-Match")
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.UpdateLedger(c.Request.Context(), userID, ledgerID, req)
+	if err != nil {
+		if err.Error() == "you don't have permission to update this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "the If-Match header is required" {
+			c.JSON(http.StatusPreconditionRequired, models.ErrorResponse{
+				Status:  "error",
+				Code:    "PRECONDITION_REQUIRED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger has been modified" {
+			c.JSON(http.StatusPreconditionFailed, models.ErrorResponse{
+				Status:  "error",
+				Code:    "PRECONDITION_FAILED",
+				Message: "Ledger has been modified. Please fetch it again and retry.",
+			})
+			return
+		}
+
+		if err.Error() == "unsupported currency" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_CURRENCY",
+				Message: "Currency must be an ISO 4217 code, such as USD",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to update ledger",
+		})
+		return
+	}
+
+	c.Header("ETag", res.Ledger.ETag())
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetLedgerEvents(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// since is optional, all events are returned without it
+	var since time.Time
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: "Invalid since parameter",
+			})
+			return
+		}
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.GetLedgerEvents(c.Request.Context(), userID, ledgerID, since)
+	if err != nil {
+		if err.Error() == "you don't have access to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to get ledger events",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ForkLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	var req models.ForkLedgerRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ForkLedger(c.Request.Context(), userID, ledgerID, req)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot create ledgers" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "you don't have access to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "atSequence is past the ledger's latest sequence number" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_SEQUENCE",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to fork ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *Handler) DeleteLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.DeleteLedger(c.Request.Context(), userID, ledgerID)
+	if err != nil {
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "you don't have permission to delete this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to delete ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ListTrashedLedgers(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ListTrashedLedgers(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot manage the trash" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list trashed ledgers",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) RestoreLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.RestoreLedger(c.Request.Context(), userID, ledgerID)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot manage the trash" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger is not in the trash" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_IN_TRASH",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "the ledger's retention period has expired" {
+			c.JSON(http.StatusGone, models.ErrorResponse{
+				Status:  "error",
+				Code:    "RETENTION_EXPIRED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to restore ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ArchiveLedger(c *gin.Context) {
+	h.setLedgerArchived(c, true)
+}
+
+func (h *Handler) UnarchiveLedger(c *gin.Context) {
+	h.setLedgerArchived(c, false)
+}
+
+// setLedgerArchived handles both archiving and unarchiving, which only differ in the call made
+func (h *Handler) setLedgerArchived(c *gin.Context, archive bool) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	var res *models.UpdateLedgerResponse
+	var err error
+	if archive {
+		res, err = h.service.ArchiveLedger(c.Request.Context(), userID, ledgerID)
+	} else {
+		res, err = h.service.UnarchiveLedger(c.Request.Context(), userID, ledgerID)
+	}
+	if err != nil {
+		if err.Error() == "you don't have permission to archive this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger is already archived" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "ALREADY_ARCHIVED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger is not archived" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_ARCHIVED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		message := "Failed to archive ledger"
+		if !archive {
+			message = "Failed to unarchive ledger"
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: message,
+		})
+		return
+	}
+
+	c.Header("ETag", res.Ledger.ETag())
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) SubmitLedgerChange(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	var req models.LedgerChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.SubmitLedgerChange(c.Request.Context(), userID, ledgerID, req)
+	if err != nil {
+		if err.Error() == "you don't have write permission for this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger is archived" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "LEDGER_ARCHIVED",
+				Message: "Ledger is archived. Unarchive it to submit changes.",
+			})
+			return
+		}
+
+		if err.Error() == "sequence number conflict" {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Status:  "error",
+				Code:    "CONFLICT",
+				Message: "Sequence number conflict. Please fetch latest changes and retry.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to submit ledger change",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) GetLedgerChanges(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get sequence range from query parameters
+	fromSeqStr := c.Query("fromSequence")
+	if fromSeqStr == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "fromSequence parameter is required",
+		})
+		return
+	}
+
+	fromSeq, err := strconv.ParseInt(fromSeqStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid fromSequence parameter",
+		})
+		return
+	}
+
+	// toSequence is optional
+	var toSeq int64 = 0
+	toSeqStr := c.Query("toSequence")
+	if toSeqStr != "" {
+		toSeq, err = strconv.ParseInt(toSeqStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: "Invalid toSequence parameter",
+			})
+			return
+		}
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.GetLedgerChanges(c.Request.Context(), userID, ledgerID, fromSeq, toSeq)
+	if err != nil {
+		if err.Error() == "you don't have access to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to get ledger changes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) AddUserToLedger(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	var req models.AddUserToLedgerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.AddUserToLedger(c.Request.Context(), userID, ledgerID, req)
+	if err != nil {
+		if err.Error() == "you don't have permission to add users to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "user has not verified their email address" {
+			c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+				Status:  "error",
+				Code:    "EMAIL_NOT_VERIFIED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to add user to ledger",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) ProposeLedgerTransfer(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	var req models.TransferLedgerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ProposeLedgerTransfer(c.Request.Context(), userID, ledgerID, req)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot transfer ledgers" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "only the owner can transfer this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "you already own this ledger" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "BAD_REQUEST",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "user is not a member of this ledger" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_A_MEMBER",
 				Message: err.Error(),
 			})
 			return
@@ -359,7 +2252,145 @@ func (h *Handler) AddUserToLedger(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Status:  "error",
 			Code:    "INTERNAL_ERROR",
-			Message: "Failed to add user to ledger",
+			Message: "Failed to propose ledger transfer",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) AcceptLedgerTransfer(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.AcceptLedgerTransfer(c.Request.Context(), userID, ledgerID)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot transfer ledgers" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "no ownership transfer is pending" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NO_PENDING_TRANSFER",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "the ownership transfer has expired" {
+			c.JSON(http.StatusGone, models.ErrorResponse{
+				Status:  "error",
+				Code:    "TRANSFER_EXPIRED",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to accept ledger transfer",
+		})
+		return
+	}
+
+	c.Header("ETag", res.Ledger.ETag())
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) CancelLedgerTransfer(c *gin.Context) {
+	ledgerID := c.Param("ledgerId")
+	if ledgerID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Ledger ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.CancelLedgerTransfer(c.Request.Context(), userID, ledgerID); err != nil {
+		if err.Error() == "personal access tokens cannot transfer ledgers" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "no ownership transfer is pending" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NO_PENDING_TRANSFER",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to cancel ledger transfer",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Ownership transfer cancelled",
+	})
+}
+
+// Ledger template handlers
+func (h *Handler) ListLedgerTemplates(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.ListLedgerTemplates(c.Request.Context(), userID)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot manage templates" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to list ledger templates",
 		})
 		return
 	}
@@ -367,6 +2398,134 @@ func (h *Handler) AddUserToLedger(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (h *Handler) SaveLedgerTemplate(c *gin.Context) {
+	var req models.SaveLedgerTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request parameters",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	res, err := h.service.SaveLedgerTemplate(c.Request.Context(), userID, req)
+	if err != nil {
+		if err.Error() == "personal access tokens cannot manage templates" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "you don't have access to this ledger" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "ledger has too many changes for a template" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "TOO_MANY_CHANGES",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "unsupported currency" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_CURRENCY",
+				Message: "Currency must be an ISO 4217 code, such as USD",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to save ledger template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (h *Handler) DeleteLedgerTemplate(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Status:  "error",
+			Code:    "BAD_REQUEST",
+			Message: "Template ID is required",
+		})
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID := c.GetString("userId")
+
+	if err := h.service.DeleteLedgerTemplate(c.Request.Context(), userID, templateID); err != nil {
+		if err.Error() == "personal access tokens cannot manage templates" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "built-in templates cannot be deleted" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err.Error() == "template not found" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Status:  "error",
+				Code:    "NOT_FOUND",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Status:  "error",
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to delete ledger template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Template deleted successfully",
+	})
+}
+
 func (h *Handler) GetLatestSequenceNumber(c *gin.Context) {
 	ledgerID := c.Param("ledgerId")
 	if ledgerID == "" {
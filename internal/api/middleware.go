@@ -1,17 +1,16 @@
 package api
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/service"
 )
 
 // AuthMiddleware returns a Gin middleware for authentication
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(svc service.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the JWT token from the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -39,17 +38,40 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		// Parse the JWT token
-		jwtSecret := c.MustGet("jwtSecret").([]byte)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid signing method")
+		// Personal access tokens are opaque and looked up in the database
+		if strings.HasPrefix(tokenString, service.PersonalAccessTokenPrefix) {
+			token, err := svc.AuthenticatePersonalAccessToken(c.Request.Context(), tokenString)
+			if err != nil {
+				if err.Error() == "invalid personal access token" {
+					c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+						Status:  "error",
+						Code:    "UNAUTHORIZED",
+						Message: "Invalid token",
+					})
+					c.Abort()
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+					Status:  "error",
+					Code:    "INTERNAL_ERROR",
+					Message: "Failed to validate token",
+				})
+				c.Abort()
+				return
 			}
-			return jwtSecret, nil
-		})
 
-		if err != nil || !token.Valid {
+			// The service limits ledger operations to the token's scope
+			c.Request = c.Request.WithContext(service.WithPersonalAccessToken(c.Request.Context(), token))
+			c.Set("userId", token.UserID)
+			c.Set("personalAccessTokenId", token.ID)
+			c.Next()
+			return
+		}
+
+		// Parse the JWT token; the key is picked by its kid header
+		claims, err := svc.ParseToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
 				Code:    "UNAUTHORIZED",
@@ -59,32 +81,79 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Extract claims from the token
-		claims, ok := token.Claims.(jwt.MapClaims)
+		// Get user ID from the token claims
+		userID, ok := claims["sub"].(string)
 		if !ok {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
 				Code:    "UNAUTHORIZED",
-				Message: "Invalid token claims",
+				Message: "Invalid user ID in token",
 			})
 			c.Abort()
 			return
 		}
 
-		// Get user ID from the token claims
-		userID, ok := claims["sub"].(string)
-		if !ok {
+		// Challenge tokens issued during two-factor login are not access tokens
+		if typ, _ := claims["typ"].(string); typ != "" && typ != "access" {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Status:  "error",
 				Code:    "UNAUTHORIZED",
-				Message: "Invalid user ID in token",
+				Message: "Invalid token",
+			})
+			c.Abort()
+			return
+		}
+
+		// Optional claims; tokens issued before revocation support don't carry them
+		tokenID, _ := claims["jti"].(string)
+		sessionID, _ := claims["sid"].(string)
+		tokenVersion, _ := claims["ver"].(float64)
+
+		// Reject tokens that were revoked by logout or "sign out everywhere"
+		if err := svc.ValidateAccessToken(c.Request.Context(), userID, tokenID, sessionID, int(tokenVersion)); err != nil {
+			if err.Error() == "token has been revoked" {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+					Status:  "error",
+					Code:    "UNAUTHORIZED",
+					Message: "Token has been revoked",
+				})
+				c.Abort()
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Status:  "error",
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to validate token",
 			})
 			c.Abort()
 			return
 		}
 
-		// Set user ID in the context
+		// Set user ID and token details in the context
 		c.Set("userId", userID)
+		c.Set("tokenId", tokenID)
+		c.Set("sessionId", sessionID)
+		if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+			c.Set("tokenExpiresAt", expiresAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects personal access tokens on endpoints that manage the account itself.
+// It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("personalAccessTokenId") != "" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Status:  "error",
+				Code:    "FORBIDDEN",
+				Message: "This endpoint requires a login session",
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,285 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// createLedger creates a ledger as the token's user and returns its ID
+func createLedger(t *testing.T, testCtx *testutils.TestContext, token, name string) string {
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: name, Currency: "USD"},
+		testutils.AuthHeaders(token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	return response.LedgerID
+}
+
+func TestExportUserData(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	ledgerID := createLedger(t, testCtx, testCtx.TestUserJWT, "Export Ledger")
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/changes", ledgerID),
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('export_entry')"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 1: The export holds the profile, memberships and authored changes
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me/export",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.NotContains(t, w.Body.String(), "password")
+
+	var export models.UserDataExport
+	err := json.Unmarshal(w.Body.Bytes(), &export)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, export.User.ID)
+	assert.Len(t, export.Memberships, 1)
+	assert.Equal(t, ledgerID, export.Memberships[0].LedgerID)
+	assert.True(t, export.Memberships[0].Owner)
+	assert.Len(t, export.Changes, 1)
+	assert.Equal(t, "INSERT INTO entries (id) VALUES ('export_entry')", export.Changes[0].SQLStatement)
+	assert.NotNil(t, export.Identities)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	sharedLedger := createLedger(t, testCtx, testCtx.TestUserJWT, "Shared Ledger")
+	privateLedger := createLedger(t, testCtx, testCtx.TestUserJWT, "Private Ledger")
+
+	// Share the first ledger with a second user who can write to it
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		models.SignUpRequest{Email: "member@example.com", Password: "Password123", Name: "Member"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/users", sharedLedger),
+		models.AddUserToLedgerRequest{Email: "member@example.com", Permissions: "write"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/changes", sharedLedger),
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('owner_entry')"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	member := testutils.Login(t, testCtx.Router, "member@example.com", "Password123")
+
+	// Test case 1: Wrong password
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/users/me",
+		models.DeleteAccountRequest{CurrentPassword: "wrongpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 2: Successful deletion
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/users/me",
+		models.DeleteAccountRequest{CurrentPassword: "testpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err := testCtx.Repository.GetUserByID(context.Background(), testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	// Test case 3: The deleted user's token no longer works
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 4: The shared ledger now belongs to the member and keeps the anonymised change
+	ledger, err := testCtx.Repository.GetLedger(context.Background(), sharedLedger)
+	assert.NoError(t, err)
+	assert.NotNil(t, ledger)
+	assert.Equal(t, member.UserID, ledger.CreatedBy)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		fmt.Sprintf("/api/ledgers/%s/changes?fromSequence=0", sharedLedger),
+		nil,
+		testutils.AuthHeaders(member.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var changes models.GetLedgerChangesResponse
+	err = json.Unmarshal(w.Body.Bytes(), &changes)
+	assert.NoError(t, err)
+	assert.Len(t, changes.Changes, 1)
+	assert.Nil(t, changes.Changes[0].UserID)
+
+	// The handoff shows up in the ledger's history
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		fmt.Sprintf("/api/ledgers/%s/events", sharedLedger),
+		nil,
+		testutils.AuthHeaders(member.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var events models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &events)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, events.Events) {
+		last := events.Events[len(events.Events)-1]
+		assert.Equal(t, models.LedgerEventOwnerChanged, last.Type)
+		assert.Nil(t, last.UserID)
+		assert.Equal(t, testCtx.TestUserID, last.Details["from"])
+		assert.Equal(t, member.UserID, last.Details["to"])
+	}
+
+	// Test case 5: The ledger nobody else could write to was deleted
+	ledger, err = testCtx.Repository.GetLedger(context.Background(), privateLedger)
+	assert.NoError(t, err)
+	assert.Nil(t, ledger)
+}
+
+func TestDeleteAccountOwnedLedgersChanged(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	sharedLedger := createLedger(t, testCtx, testCtx.TestUserJWT, "Shared Ledger")
+
+	for _, email := range []string{"member@example.com", "reader@example.com"} {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/signup",
+			models.SignUpRequest{Email: email, Password: "Password123", Name: "Member"},
+			nil,
+		)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	for email, permissions := range map[string]string{"member@example.com": "write", "reader@example.com": "read"} {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			fmt.Sprintf("/api/ledgers/%s/users", sharedLedger),
+			models.AddUserToLedgerRequest{Email: email, Permissions: permissions},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	member := testutils.Login(t, testCtx.Router, "member@example.com", "Password123")
+	reader := testutils.Login(t, testCtx.Router, "reader@example.com", "Password123")
+
+	// The plan for the owned ledgers is made before this ledger is created
+	plan := map[string]string{sharedLedger: member.UserID}
+	newLedger := createLedger(t, testCtx, testCtx.TestUserJWT, "New Ledger")
+
+	// Test case 1: A plan that misses a ledger the user now owns is refused, and nothing is deleted
+	err := testCtx.Repository.DeleteUser(context.Background(), testCtx.TestUserID, plan, nil)
+	assert.ErrorIs(t, err, repository.ErrOwnedLedgersChanged)
+
+	user, err := testCtx.Repository.GetUserByID(context.Background(), testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+
+	for _, ledgerID := range []string{sharedLedger, newLedger} {
+		ledger, err := testCtx.Repository.GetLedger(context.Background(), ledgerID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, ledger) {
+			assert.Equal(t, testCtx.TestUserID, ledger.CreatedBy)
+		}
+	}
+
+	// Test case 2: A successor who can no longer write to the ledger is refused too
+	err = testCtx.Repository.DeleteUser(
+		context.Background(),
+		testCtx.TestUserID,
+		map[string]string{sharedLedger: reader.UserID},
+		[]string{newLedger},
+	)
+	assert.ErrorIs(t, err, repository.ErrOwnedLedgersChanged)
+
+	// Test case 3: Deleting the account plans with the ledgers owned at the time
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/users/me",
+		models.DeleteAccountRequest{CurrentPassword: "testpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	ledger, err := testCtx.Repository.GetLedger(context.Background(), sharedLedger)
+	assert.NoError(t, err)
+	if assert.NotNil(t, ledger) {
+		assert.Equal(t, member.UserID, ledger.CreatedBy)
+	}
+
+	ledger, err = testCtx.Repository.GetLedger(context.Background(), newLedger)
+	assert.NoError(t, err)
+	assert.Nil(t, ledger)
+}
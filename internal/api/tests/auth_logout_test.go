@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogout(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	session := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	otherSession := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 1: The token works before logout
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Logout Ledger", Currency: "USD"},
+		testutils.AuthHeaders(session.Token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 2: Successful logout
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/logout",
+		nil,
+		testutils.AuthHeaders(session.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 3: The revoked token is rejected
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Logout Ledger", Currency: "USD"},
+		testutils.AuthHeaders(session.Token),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 4: The refresh token of the same login is revoked too
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: session.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 5: Other sessions are unaffected
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Other Session Ledger", Currency: "USD"},
+		testutils.AuthHeaders(otherSession.Token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 6: Unauthorized request (no token)
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/logout",
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	session := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	otherSession := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 1: Successful logout from all sessions
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/logout-all",
+		nil,
+		testutils.AuthHeaders(session.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 2: Every previously issued access token is rejected
+	for _, token := range []string{session.Token, otherSession.Token, testCtx.TestUserJWT} {
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodGet,
+			"/api/ledgers/any-ledger/sequence",
+			nil,
+			testutils.AuthHeaders(token),
+		)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Test case 3: Every refresh token is rejected
+	for _, refreshToken := range []string{session.RefreshToken, otherSession.RefreshToken} {
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/refresh",
+			models.RefreshTokenRequest{RefreshToken: refreshToken},
+			nil,
+		)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Test case 4: A fresh login works again
+	newSession := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "New Session Ledger", Currency: "USD"},
+		testutils.AuthHeaders(newSession.Token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
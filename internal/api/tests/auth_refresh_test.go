@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshToken(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Log in to obtain the first refresh token
+	loginReq := models.LoginRequest{
+		Email:    "testuser@example.com",
+		Password: "testpassword",
+	}
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		loginReq,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loginResponse models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &loginResponse)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, loginResponse.Token)
+	assert.NotEmpty(t, loginResponse.RefreshToken)
+
+	// Test case 1: Refresh returns a new token pair
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: loginResponse.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refreshResponse models.AuthResponse
+	err = json.Unmarshal(w.Body.Bytes(), &refreshResponse)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, refreshResponse.Token)
+	assert.NotEmpty(t, refreshResponse.RefreshToken)
+	assert.NotEqual(t, loginResponse.RefreshToken, refreshResponse.RefreshToken)
+
+	// The new access token works on authenticated endpoints
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Refreshed Ledger", Currency: "USD"},
+		testutils.AuthHeaders(refreshResponse.Token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 2: Reusing the old refresh token is rejected
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: loginResponse.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 3: Reuse revoked the whole family, including the latest token
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: refreshResponse.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 4: Unknown refresh token
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: "not-a-real-token"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 5: Missing refresh token
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
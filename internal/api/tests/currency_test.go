@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrencies(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Anyone can list the supported currencies with their minor units
+	w := testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/currencies", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var currenciesResponse models.CurrenciesResponse
+	err := json.Unmarshal(w.Body.Bytes(), &currenciesResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", currenciesResponse.Status)
+
+	minorUnits := map[string]int{}
+	for _, currency := range currenciesResponse.Currencies {
+		minorUnits[currency.Code] = currency.MinorUnits
+	}
+	assert.Equal(t, 2, minorUnits["USD"])
+	assert.Equal(t, 0, minorUnits["JPY"])
+	assert.Equal(t, 3, minorUnits["BHD"])
+
+	// Test case 2: Currency codes are stored in upper case
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Groceries", Currency: "usd"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerPath := fmt.Sprintf("/api/ledgers/%s", ledgerResponse.LedgerID)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var detailsResponse models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &detailsResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", detailsResponse.Ledger.Currency)
+	etag := w.Header().Get("ETag")
+
+	// Test case 3: Codes that aren't ISO 4217 currencies are rejected
+	for _, code := range []string{"XX", "ABC", "€"} {
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/ledgers",
+			models.CreateLedgerRequest{Name: "Bad Currency", Currency: code},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	// Test case 4: Updates are validated and normalised the same way
+	patchCurrency := func(currency string) {
+		headers := testutils.AuthHeaders(testCtx.TestUserJWT)
+		headers["If-Match"] = etag
+		w = testutils.PerformRequest(testCtx.Router, http.MethodPatch, ledgerPath, models.UpdateLedgerRequest{Currency: &currency}, headers)
+	}
+
+	patchCurrency("EURO")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errorResponse models.ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "INVALID_CURRENCY", errorResponse.Code)
+
+	patchCurrency(" eur ")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updateResponse models.UpdateLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &updateResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", updateResponse.Ledger.Currency)
+
+	// Test case 5: Ledgers can be filtered by currency in any case
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers?currency=eur", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var listResponse models.ListLedgersResponse
+	err = json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.NoError(t, err)
+	assert.Len(t, listResponse.Ledgers, 1)
+}
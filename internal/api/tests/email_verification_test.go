@@ -0,0 +1,207 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailVerification(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Signing up sends a verification email
+	signupReq := models.SignUpRequest{
+		Email:    "verify@example.com",
+		Password: "Password123",
+		Name:     "Verify User",
+	}
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		signupReq,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, testCtx.MailLog.String(), "To: verify@example.com")
+
+	verificationToken := testCtx.MailLog.LastMailToken()
+	assert.NotEmpty(t, verificationToken)
+
+	// Test case 1: Successful verification
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify",
+		models.VerifyEmailRequest{Token: verificationToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err := testCtx.Repository.GetUserByEmail(context.Background(), "verify@example.com")
+	assert.NoError(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	// Test case 2: The token can only be used once
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify",
+		models.VerifyEmailRequest{Token: verificationToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 3: Verified accounts don't get another email
+	mailLength := len(testCtx.MailLog.String())
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify/resend",
+		models.ResendVerificationRequest{Email: "verify@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, mailLength, len(testCtx.MailLog.String()))
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	t.Setenv("REQUIRE_VERIFIED_EMAIL_LOGIN", "true")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		models.SignUpRequest{Email: "unverified@example.com", Password: "Password123", Name: "Unverified"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 1: Unverified users can't log in
+	loginReq := models.LoginRequest{
+		Email:    "unverified@example.com",
+		Password: "Password123",
+	}
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		loginReq,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var errorResponse models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "EMAIL_NOT_VERIFIED", errorResponse.Code)
+
+	// Test case 2: A resent link verifies the account and login succeeds
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify/resend",
+		models.ResendVerificationRequest{Email: "unverified@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify",
+		models.VerifyEmailRequest{Token: testCtx.MailLog.LastMailToken()},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	testutils.Login(t, testCtx.Router, "unverified@example.com", "Password123")
+}
+
+func TestSharingRequiresVerifiedEmail(t *testing.T) {
+	t.Setenv("REQUIRE_VERIFIED_EMAIL_SHARING", "true")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		models.SignUpRequest{Email: "invitee@example.com", Password: "Password123", Name: "Invitee"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	verificationToken := testCtx.MailLog.LastMailToken()
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Shared Ledger", Currency: "USD"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+
+	shareReq := models.AddUserToLedgerRequest{
+		Email:       "invitee@example.com",
+		Permissions: "read",
+	}
+
+	// Test case 1: Unverified users can't be added
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers/"+ledgerResponse.LedgerID+"/users",
+		shareReq,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Test case 2: After verification the user can be added
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/verify",
+		models.VerifyEmailRequest{Token: verificationToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers/"+ledgerResponse.LedgerID+"/users",
+		shareReq,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
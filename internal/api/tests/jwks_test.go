@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/keyset"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsymmetricSigningAndJWKS(t *testing.T) {
+	// The old Ed25519 key is being rotated out in favour of a new RSA key
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	oldPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	oldDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(oldDir, "2026-01.pem"), oldPEM, 0o600))
+
+	keysDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, "2026-01.pem"), oldPEM, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, "2026-02.pem"), newPEM, 0o600))
+
+	t.Setenv("JWT_KEYS_DIR", keysDir)
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Both keys are published
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/.well-known/jwks.json",
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var jwks models.JWKSResponse
+	err = json.Unmarshal(w.Body.Bytes(), &jwks)
+	assert.NoError(t, err)
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "2026-01", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "2026-02", jwks.Keys[1].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+
+	// Test case 2: New tokens are signed with the newest key and verify against the published JWK
+	session := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	n, err := base64.RawURLEncoding.DecodeString(jwks.Keys[1].N)
+	require.NoError(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwks.Keys[1].E)
+	require.NoError(t, err)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	token, err := jwt.Parse(session.Token, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-02", token.Header["kid"])
+
+	// Test case 3: Tokens signed before the rotation are still accepted
+	oldKeys, err := keyset.Load(oldDir, "")
+	require.NoError(t, err)
+
+	oldToken, err := oldKeys.Sign(jwt.MapClaims{
+		"sub": testCtx.TestUserID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	})
+	require.NoError(t, err)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Rotated Ledger", Currency: "USD"},
+		testutils.AuthHeaders(oldToken),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 4: HMAC tokens are rejected once asymmetric keys are configured
+	hmacToken, err := keyset.NewHMAC([]byte("test-secret-key")).Sign(jwt.MapClaims{
+		"sub": testCtx.TestUserID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Forged Ledger", Currency: "USD"},
+		testutils.AuthHeaders(hmacToken),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerArchive(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Ski Trip", Currency: "NZD"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerID := ledgerResponse.LedgerID
+	ledgerPath := fmt.Sprintf("/api/ledgers/%s", ledgerID)
+
+	// Share the ledger with a member who can write
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+		Email:    "skier@example.com",
+		Password: "Password123",
+		Name:     "Skier",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/users",
+		models.AddUserToLedgerRequest{Email: "skier@example.com", Permissions: "write"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+	skier := testutils.Login(t, testCtx.Router, "skier@example.com", "Password123")
+
+	submitChange := func(token string) int {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			ledgerPath+"/changes",
+			models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('lift-pass')"},
+			testutils.AuthHeaders(token),
+		)
+		return w.Code
+	}
+
+	listLedgers := func(query string) []models.LedgerSummary {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers"+query, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.ListLedgersResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Ledgers
+	}
+
+	assert.Equal(t, http.StatusOK, submitChange(skier.Token))
+
+	// Test case 1: Members with write access can't archive the ledger
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/archive", nil, testutils.AuthHeaders(skier.Token))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 2: The owner archives it
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/archive", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var archiveResponse models.UpdateLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &archiveResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", archiveResponse.Status)
+	assert.NotNil(t, archiveResponse.Ledger.ArchivedAt)
+
+	// Test case 3: Archiving it again is a conflict
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/archive", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 4: Changes are rejected while it is archived
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/changes",
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('apres')"},
+		testutils.AuthHeaders(skier.Token),
+	)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var errorResponse models.ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "LEDGER_ARCHIVED", errorResponse.Code)
+
+	// Test case 5: Reads keep working
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(skier.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/changes?fromSequence=1", nil, testutils.AuthHeaders(skier.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var changesResponse models.GetLedgerChangesResponse
+	err = json.Unmarshal(w.Body.Bytes(), &changesResponse)
+	assert.NoError(t, err)
+	assert.Len(t, changesResponse.Changes, 1)
+
+	// Test case 6: Listing leaves archived ledgers out unless asked for
+	assert.Empty(t, listLedgers(""))
+	assert.Len(t, listLedgers("?archived=include"), 1)
+	if only := listLedgers("?archived=only"); assert.Len(t, only, 1) {
+		assert.Equal(t, ledgerID, only[0].ID)
+		assert.NotNil(t, only[0].ArchivedAt)
+	}
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers?archived=maybe", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 7: Unarchiving makes it writable again
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/unarchive", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, submitChange(skier.Token))
+	assert.Len(t, listLedgers(""), 1)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/unarchive", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 8: Both are recorded in the ledger's history
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/events", nil, testutils.AuthHeaders(skier.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsResponse models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, eventsResponse.Events, 2) {
+		assert.Equal(t, models.LedgerEventArchived, eventsResponse.Events[0].Type)
+		assert.Equal(t, models.LedgerEventUnarchived, eventsResponse.Events[1].Type)
+	}
+}
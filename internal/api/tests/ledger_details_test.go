@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLedgerDetails(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Create a ledger and share it with a second user
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{
+			Name:        "Flat Expenses",
+			Description: "Rent, power and internet",
+			Currency:    "AUD",
+		},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerID := ledgerResponse.LedgerID
+
+	for _, email := range []string{"flatmate@example.com", "stranger@example.com"} {
+		w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+			Email:    email,
+			Password: "Password123",
+			Name:     "Other User",
+		}, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/users", ledgerID),
+		models.AddUserToLedgerRequest{Email: "flatmate@example.com", Permissions: "read"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	getLedger := func(token, id string) *httptest.ResponseRecorder {
+		return testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodGet,
+			fmt.Sprintf("/api/ledgers/%s", id),
+			nil,
+			testutils.AuthHeaders(token),
+		)
+	}
+
+	// Test case 1: The owner gets the ledger with its members
+	w = getLedger(testCtx.TestUserJWT, ledgerID)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", response.Status)
+	assert.Equal(t, ledgerID, response.Ledger.ID)
+	assert.Equal(t, "Flat Expenses", response.Ledger.Name)
+	assert.Equal(t, "Rent, power and internet", response.Ledger.Description)
+	assert.Equal(t, "AUD", response.Ledger.Currency)
+	assert.Equal(t, testCtx.TestUserID, response.Ledger.CreatedBy)
+
+	if assert.NotNil(t, response.Owner) {
+		assert.Equal(t, testCtx.TestUserID, response.Owner.UserID)
+		assert.Equal(t, "testuser@example.com", response.Owner.Email)
+		assert.Equal(t, "Test User", response.Owner.Name)
+	}
+
+	if assert.Len(t, response.Members, 2) {
+		assert.Equal(t, testCtx.TestUserID, response.Members[0].UserID)
+		assert.True(t, response.Members[0].Owner)
+		assert.Equal(t, "write", response.Members[0].Permissions)
+
+		assert.Equal(t, "flatmate@example.com", response.Members[1].Email)
+		assert.Equal(t, "Other User", response.Members[1].Name)
+		assert.False(t, response.Members[1].Owner)
+		assert.Equal(t, "read", response.Members[1].Permissions)
+	}
+
+	// Test case 2: A member with read access can see the ledger too
+	flatmate := testutils.Login(t, testCtx.Router, "flatmate@example.com", "Password123")
+	w = getLedger(flatmate.Token, ledgerID)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 3: Users who aren't members are refused
+	stranger := testutils.Login(t, testCtx.Router, "stranger@example.com", "Password123")
+	w = getLedger(stranger.Token, ledgerID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 4: Unknown ledgers look the same as ledgers the user can't see
+	w = getLedger(testCtx.TestUserJWT, uuid.New().String())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 5: Unauthenticated requests are rejected
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, fmt.Sprintf("/api/ledgers/%s", ledgerID), nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,198 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForkLedger(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Household", Description: "Shared bills", Currency: "EUR"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	sourceID := ledgerResponse.LedgerID
+	sourcePath := fmt.Sprintf("/api/ledgers/%s", sourceID)
+
+	statements := []string{
+		"INSERT INTO entries (id, amount) VALUES ('rent', 1200)",
+		"INSERT INTO entries (id, amount) VALUES ('power', 85)",
+		"DELETE FROM entries WHERE id = 'power'",
+	}
+	for _, statement := range statements {
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			sourcePath+"/changes",
+			models.LedgerChangeRequest{SQLStatement: statement},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// A member with read access, and someone who isn't a member
+	for _, email := range []string{"mover@example.com", "stranger@example.com"} {
+		w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+			Email:    email,
+			Password: "Password123",
+			Name:     "Other User",
+		}, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		sourcePath+"/users",
+		models.AddUserToLedgerRequest{Email: "mover@example.com", Permissions: "read"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mover := testutils.Login(t, testCtx.Router, "mover@example.com", "Password123")
+	stranger := testutils.Login(t, testCtx.Router, "stranger@example.com", "Password123")
+
+	fork := func(token, query string) (int, models.LedgerResponse) {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodPost, sourcePath+"/fork"+query, nil, testutils.AuthHeaders(token))
+
+		var response models.LedgerResponse
+		if w.Code == http.StatusCreated {
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+		}
+		return w.Code, response
+	}
+
+	// Test case 1: A member with read access forks the ledger at sequence 2
+	code, forked := fork(mover.Token, "?atSequence=2")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "Household (fork)", forked.Name)
+	assert.Equal(t, int64(2), forked.InitialSequenceNumber)
+	assert.NotEqual(t, sourceID, forked.LedgerID)
+	forkPath := fmt.Sprintf("/api/ledgers/%s", forked.LedgerID)
+
+	// The caller owns the fork, which keeps the source's details
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, forkPath, nil, testutils.AuthHeaders(mover.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var details models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &details)
+	assert.NoError(t, err)
+	assert.Equal(t, mover.UserID, details.Ledger.CreatedBy)
+	assert.Equal(t, "Shared bills", details.Ledger.Description)
+	assert.Equal(t, "EUR", details.Ledger.Currency)
+	assert.Len(t, details.Members, 1)
+
+	// Test case 2: The fork holds a copy of the changes up to the sequence, numbered from 1
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, forkPath+"/changes?fromSequence=1", nil, testutils.AuthHeaders(mover.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var changesResponse models.GetLedgerChangesResponse
+	err = json.Unmarshal(w.Body.Bytes(), &changesResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), changesResponse.LatestSequenceNumber)
+	if assert.Len(t, changesResponse.Changes, 2) {
+		for i, change := range changesResponse.Changes {
+			assert.Equal(t, int64(i+1), change.SequenceNumber)
+			assert.Equal(t, statements[i], change.SQLStatement)
+			assert.Equal(t, testCtx.TestUserID, *change.UserID)
+		}
+	}
+
+	// New changes continue from the copied ones, and the source is untouched
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		forkPath+"/changes",
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id, amount) VALUES ('bond', 2400)"},
+		testutils.AuthHeaders(mover.Token),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var changeResponse models.LedgerChangeResponse
+	err = json.Unmarshal(w.Body.Bytes(), &changeResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), changeResponse.AssignedSequenceNumber)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, sourcePath+"/sequence", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	var sequenceResponse models.SequenceNumberResponse
+	err = json.Unmarshal(w.Body.Bytes(), &sequenceResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sequenceResponse.LatestSequenceNumber)
+
+	// Test case 3: The fork's history records where it came from
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, forkPath+"/events", nil, testutils.AuthHeaders(mover.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsResponse models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, eventsResponse.Events, 1) {
+		assert.Equal(t, models.LedgerEventForked, eventsResponse.Events[0].Type)
+		assert.Equal(t, sourceID, eventsResponse.Events[0].Details["sourceLedgerId"])
+		assert.Equal(t, float64(2), eventsResponse.Events[0].Details["atSequence"])
+	}
+
+	// Test case 4: Forking at 0 gives an empty ledger with the given name
+	code, forked = fork(testCtx.TestUserJWT, "?atSequence=0&name=Fresh+Start")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "Fresh Start", forked.Name)
+	assert.Equal(t, int64(0), forked.InitialSequenceNumber)
+
+	// The default name is shortened to fit when the source's name is already at the limit
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: strings.Repeat("é", 255), Currency: "EUR"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/fork?atSequence=0", ledgerResponse.LedgerID),
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &forked)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("é", 248)+" (fork)", forked.Name)
+
+	// Test case 5: Invalid sequences are rejected
+	code, _ = fork(testCtx.TestUserJWT, "?atSequence=4")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = fork(testCtx.TestUserJWT, "?atSequence=-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = fork(testCtx.TestUserJWT, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Test case 6: Users who can't read the ledger can't fork it
+	code, _ = fork(stranger.Token, "?atSequence=1")
+	assert.Equal(t, http.StatusForbidden, code)
+}
@@ -0,0 +1,188 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListLedgers(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	createLedger := func(token, name, currency string) string {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/ledgers",
+			models.CreateLedgerRequest{Name: name, Currency: currency},
+			testutils.AuthHeaders(token),
+		)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.LedgerResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.LedgerID
+	}
+
+	listLedgers := func(query string) models.ListLedgersResponse {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodGet,
+			"/api/ledgers"+query,
+			nil,
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response models.ListLedgersResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	ledgerIDs := func(ledgers []models.LedgerSummary) []string {
+		ids := []string{}
+		for _, ledger := range ledgers {
+			ids = append(ids, ledger.ID)
+		}
+		return ids
+	}
+
+	// Test case 1: A new user has no ledgers
+	response := listLedgers("")
+	assert.Equal(t, "success", response.Status)
+	assert.Empty(t, response.Ledgers)
+	assert.Empty(t, response.NextCursor)
+
+	// Create ledgers of our own and one shared with us by another user
+	groceries := createLedger(testCtx.TestUserJWT, "Groceries", "USD")
+	rent := createLedger(testCtx.TestUserJWT, "Rent", "AUD")
+	bills := createLedger(testCtx.TestUserJWT, "Bills", "USD")
+
+	w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+		Email:    "listowner@example.com",
+		Password: "Password123",
+		Name:     "List Owner",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	otherUser := testutils.Login(t, testCtx.Router, "listowner@example.com", "Password123")
+
+	trip := createLedger(otherUser.Token, "Trip", "EUR")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/users", trip),
+		models.AddUserToLedgerRequest{Email: "testuser@example.com", Permissions: "read"},
+		testutils.AuthHeaders(otherUser.Token),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A ledger we don't belong to is never listed
+	createLedger(otherUser.Token, "Private", "USD")
+
+	// Record some activity on the oldest ledger
+	for i := 0; i < 2; i++ {
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			fmt.Sprintf("/api/ledgers/%s/changes", groceries),
+			models.LedgerChangeRequest{SQLStatement: fmt.Sprintf("INSERT INTO entries (id) VALUES ('entry%d')", i)},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Test case 2: By default the most recently active ledger comes first
+	response = listLedgers("")
+	assert.Len(t, response.Ledgers, 4)
+	assert.Equal(t, groceries, response.Ledgers[0].ID)
+	assert.Empty(t, response.NextCursor)
+
+	for _, ledger := range response.Ledgers {
+		switch ledger.ID {
+		case groceries:
+			assert.Equal(t, "write", ledger.Permissions)
+			assert.True(t, ledger.Owner)
+			assert.Equal(t, 1, ledger.MemberCount)
+			assert.Equal(t, int64(2), ledger.LatestSequenceNumber)
+			assert.False(t, ledger.LastActivityAt.IsZero())
+		case trip:
+			assert.Equal(t, "read", ledger.Permissions)
+			assert.False(t, ledger.Owner)
+			assert.Equal(t, 2, ledger.MemberCount)
+			assert.Equal(t, int64(0), ledger.LatestSequenceNumber)
+			assert.Equal(t, "Trip", ledger.Name)
+			assert.Equal(t, "EUR", ledger.Currency)
+		}
+	}
+
+	// Test case 3: Sort by name
+	response = listLedgers("?sort=name")
+	assert.Equal(t, []string{bills, groceries, rent, trip}, ledgerIDs(response.Ledgers))
+
+	response = listLedgers("?sort=name&order=desc")
+	assert.Equal(t, []string{trip, rent, groceries, bills}, ledgerIDs(response.Ledgers))
+
+	// Test case 4: Filter by ownership and currency
+	response = listLedgers("?ownership=shared")
+	assert.Equal(t, []string{trip}, ledgerIDs(response.Ledgers))
+
+	response = listLedgers("?ownership=owned&sort=name")
+	assert.Equal(t, []string{bills, groceries, rent}, ledgerIDs(response.Ledgers))
+
+	response = listLedgers("?currency=usd&sort=name")
+	assert.Equal(t, []string{bills, groceries}, ledgerIDs(response.Ledgers))
+
+	// Test case 5: Page through the ledgers two at a time
+	response = listLedgers("?sort=name&limit=2")
+	assert.Equal(t, []string{bills, groceries}, ledgerIDs(response.Ledgers))
+	assert.NotEmpty(t, response.NextCursor)
+
+	response = listLedgers("?sort=name&limit=2&cursor=" + response.NextCursor)
+	assert.Equal(t, []string{rent, trip}, ledgerIDs(response.Ledgers))
+	assert.Empty(t, response.NextCursor)
+
+	// Timestamps survive the round trip through the cursor
+	response = listLedgers("?sort=createdAt&order=asc&limit=3")
+	assert.Equal(t, []string{groceries, rent, bills}, ledgerIDs(response.Ledgers))
+
+	response = listLedgers("?sort=createdAt&order=asc&limit=3&cursor=" + response.NextCursor)
+	assert.Equal(t, []string{trip}, ledgerIDs(response.Ledgers))
+
+	// Test case 6: A cursor only works with the sort it was issued for
+	response = listLedgers("?sort=name&limit=2")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/ledgers?sort=createdAt&limit=2&cursor="+response.NextCursor,
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errorResponse models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "INVALID_CURSOR", errorResponse.Code)
+
+	// Test case 7: Malformed cursors and parameters are rejected
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers?cursor=not-a-cursor", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers?sort=size", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers?limit=500", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 8: Unauthenticated requests are rejected
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,181 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerTemplates(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+		Email:    "other@example.com",
+		Password: "Password123",
+		Name:     "Other User",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	other := testutils.Login(t, testCtx.Router, "other@example.com", "Password123")
+
+	createLedger := func(token string, req models.CreateLedgerRequest) (int, models.LedgerResponse) {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/ledgers", req, testutils.AuthHeaders(token))
+
+		var response models.LedgerResponse
+		if w.Code == http.StatusCreated {
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+		}
+		return w.Code, response
+	}
+
+	getChanges := func(ledgerID string) []models.LedgerChange {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodGet,
+			fmt.Sprintf("/api/ledgers/%s/changes?fromSequence=1", ledgerID),
+			nil,
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.GetLedgerChangesResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Changes
+	}
+
+	saveTemplate := func(token string, req models.SaveLedgerTemplateRequest) (int, models.LedgerTemplate) {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/ledger-templates", req, testutils.AuthHeaders(token))
+
+		var response models.LedgerTemplateResponse
+		if w.Code == http.StatusCreated {
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+		}
+		return w.Code, response.Template
+	}
+
+	// Test case 1: The built-in templates are listed
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledger-templates", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var listResponse models.LedgerTemplatesResponse
+	err := json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.NoError(t, err)
+
+	var trip *models.LedgerTemplate
+	for i, template := range listResponse.Templates {
+		assert.True(t, template.Builtin)
+		if template.ID == "trip" {
+			trip = &listResponse.Templates[i]
+		}
+	}
+	if !assert.NotNil(t, trip) {
+		return
+	}
+
+	// Test case 2: A ledger made from a template starts with its seed changes
+	code, _ := createLedger(testCtx.TestUserJWT, models.CreateLedgerRequest{Name: "Japan", TemplateID: "trip"})
+	assert.Equal(t, http.StatusBadRequest, code, "the trip template has no currency")
+
+	code, japan := createLedger(testCtx.TestUserJWT, models.CreateLedgerRequest{Name: "Japan", Currency: "JPY", TemplateID: "trip"})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, int64(len(trip.Statements)), japan.InitialSequenceNumber)
+
+	changes := getChanges(japan.LedgerID)
+	if assert.Len(t, changes, len(trip.Statements)) {
+		for i, change := range changes {
+			assert.Equal(t, int64(i+1), change.SequenceNumber)
+			assert.Equal(t, int64(i), change.BaseSequenceNum)
+			assert.Equal(t, trip.Statements[i], change.SQLStatement)
+			assert.Equal(t, testCtx.TestUserID, *change.UserID)
+		}
+	}
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers/"+japan.LedgerID, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	var details models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &details)
+	assert.NoError(t, err)
+	assert.Equal(t, trip.Description, details.Ledger.Description)
+
+	// New changes follow the seed changes
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		fmt.Sprintf("/api/ledgers/%s/changes", japan.LedgerID),
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id, amount) VALUES ('rail-pass', 50000)"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var changeResponse models.LedgerChangeResponse
+	err = json.Unmarshal(w.Body.Bytes(), &changeResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(trip.Statements)+1), changeResponse.AssignedSequenceNumber)
+
+	// Test case 3: Users can save their own templates, with default details
+	code, flat := saveTemplate(testCtx.TestUserJWT, models.SaveLedgerTemplateRequest{
+		Name:       "Flat",
+		Currency:   "AUD",
+		Statements: []string{"INSERT INTO categories (id, name) VALUES ('bond', 'Bond')"},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.False(t, flat.Builtin)
+
+	code, flatLedger := createLedger(testCtx.TestUserJWT, models.CreateLedgerRequest{Name: "Flat 2026", TemplateID: flat.ID})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, int64(1), flatLedger.InitialSequenceNumber)
+
+	// Test case 4: Or save one from an existing ledger's changes
+	code, fromLedger := saveTemplate(testCtx.TestUserJWT, models.SaveLedgerTemplateRequest{Name: "Japan Again", LedgerID: japan.LedgerID})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "JPY", fromLedger.Currency)
+	assert.Len(t, fromLedger.Statements, len(trip.Statements)+1)
+
+	code, _ = saveTemplate(testCtx.TestUserJWT, models.SaveLedgerTemplateRequest{
+		Name:       "Both",
+		LedgerID:   japan.LedgerID,
+		Statements: []string{"INSERT INTO categories (id, name) VALUES ('misc', 'Misc')"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = saveTemplate(other.Token, models.SaveLedgerTemplateRequest{Name: "Stolen", LedgerID: japan.LedgerID})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Test case 5: Saved templates are private
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledger-templates", nil, testutils.AuthHeaders(other.Token))
+	err = json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.NoError(t, err)
+	for _, template := range listResponse.Templates {
+		assert.True(t, template.Builtin)
+	}
+
+	code, _ = createLedger(other.Token, models.CreateLedgerRequest{Name: "Copy", Currency: "AUD", TemplateID: flat.ID})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, "/api/ledger-templates/"+flat.ID, nil, testutils.AuthHeaders(other.Token))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Test case 6: Saved templates can be deleted, built-in ones can't
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, "/api/ledger-templates/trip", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, "/api/ledger-templates/"+flat.ID, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	code, _ = createLedger(testCtx.TestUserJWT, models.CreateLedgerRequest{Name: "Flat 2027", Currency: "AUD", TemplateID: flat.ID})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// The ledger made from it keeps its changes
+	assert.Len(t, getChanges(flatLedger.LedgerID), 1)
+
+	// Test case 7: Unknown templates are rejected
+	code, _ = createLedger(testCtx.TestUserJWT, models.CreateLedgerRequest{Name: "Mystery", Currency: "AUD", TemplateID: "no-such-template"})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
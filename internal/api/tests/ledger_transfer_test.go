@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerOwnershipTransfer(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Flat 4B", Currency: "AUD"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerID := ledgerResponse.LedgerID
+	ledgerPath := fmt.Sprintf("/api/ledgers/%s", ledgerID)
+
+	// A flatmate with read access, and someone who isn't a member
+	for _, email := range []string{"flatmate@example.com", "stranger@example.com"} {
+		w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+			Email:    email,
+			Password: "Password123",
+			Name:     "Other User",
+		}, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/users",
+		models.AddUserToLedgerRequest{Email: "flatmate@example.com", Permissions: "read"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	flatmate := testutils.Login(t, testCtx.Router, "flatmate@example.com", "Password123")
+	stranger := testutils.Login(t, testCtx.Router, "stranger@example.com", "Password123")
+
+	propose := func(token, email string) int {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			ledgerPath+"/transfer",
+			models.TransferLedgerRequest{Email: email},
+			testutils.AuthHeaders(token),
+		)
+		return w.Code
+	}
+
+	accept := func(token string) int {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/transfer/accept", nil, testutils.AuthHeaders(token))
+		return w.Code
+	}
+
+	// Test case 1: Only the owner can propose a transfer, and only to a member
+	assert.Equal(t, http.StatusForbidden, propose(flatmate.Token, "flatmate@example.com"))
+	assert.Equal(t, http.StatusBadRequest, propose(testCtx.TestUserJWT, "stranger@example.com"))
+	assert.Equal(t, http.StatusBadRequest, propose(testCtx.TestUserJWT, "nobody@example.com"))
+	assert.Equal(t, http.StatusBadRequest, propose(testCtx.TestUserJWT, "testuser@example.com"))
+
+	// Test case 2: Nothing changes until the proposal is accepted
+	assert.Equal(t, http.StatusOK, propose(testCtx.TestUserJWT, "flatmate@example.com"))
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var details models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &details)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, details.Ledger.CreatedBy)
+	if assert.NotNil(t, details.PendingTransfer) {
+		assert.Equal(t, testCtx.TestUserID, details.PendingTransfer.FromUserID)
+		assert.Equal(t, flatmate.UserID, details.PendingTransfer.ToUserID)
+	}
+
+	// Test case 3: Only the recipient can accept it
+	assert.Equal(t, http.StatusNotFound, accept(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusNotFound, accept(stranger.Token))
+
+	// Test case 4: The recipient can decline it
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath+"/transfer", nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNotFound, accept(flatmate.Token))
+
+	// Test case 5: An expired proposal can't be accepted
+	assert.Equal(t, http.StatusOK, propose(testCtx.TestUserJWT, "flatmate@example.com"))
+
+	_, err = testCtx.DB.Exec(
+		`UPDATE ledger_transfers SET expires_at = $1 WHERE ledger_id = $2`,
+		time.Now().UTC().Add(-time.Minute), ledgerID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, accept(flatmate.Token))
+
+	// Test case 6: Accepting makes the recipient the owner
+	assert.Equal(t, http.StatusOK, propose(testCtx.TestUserJWT, "flatmate@example.com"))
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/transfer/accept", nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var acceptResponse models.UpdateLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &acceptResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, flatmate.UserID, acceptResponse.Ledger.CreatedBy)
+
+	// The previous owner stays on as an admin and the new owner can write
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	details = models.LedgerDetailsResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &details)
+	assert.NoError(t, err)
+	assert.Nil(t, details.PendingTransfer)
+	if assert.NotNil(t, details.Owner) {
+		assert.Equal(t, flatmate.UserID, details.Owner.UserID)
+		assert.Equal(t, "write", details.Owner.Permissions)
+	}
+	for _, member := range details.Members {
+		if member.UserID == testCtx.TestUserID {
+			assert.False(t, member.Owner)
+			assert.Equal(t, "admin", member.Permissions)
+		}
+	}
+
+	// Test case 7: The transfer is recorded in the ledger's history
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/events", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsResponse models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, eventsResponse.Events, 1) {
+		event := eventsResponse.Events[0]
+		assert.Equal(t, models.LedgerEventOwnerChanged, event.Type)
+		assert.Equal(t, flatmate.UserID, *event.UserID)
+		assert.Equal(t, testCtx.TestUserID, event.Details["from"])
+		assert.Equal(t, flatmate.UserID, event.Details["to"])
+	}
+
+	// Test case 8: Only the new owner can delete the ledger now
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath, nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
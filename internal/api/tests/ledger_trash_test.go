@@ -0,0 +1,164 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerTrash(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Old Flat", Currency: "GBP"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerID := ledgerResponse.LedgerID
+	ledgerPath := fmt.Sprintf("/api/ledgers/%s", ledgerID)
+
+	// Share the ledger with a member
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+		Email:    "flatmate@example.com",
+		Password: "Password123",
+		Name:     "Flatmate",
+	}, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/users",
+		models.AddUserToLedgerRequest{Email: "flatmate@example.com", Permissions: "write"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+	flatmate := testutils.Login(t, testCtx.Router, "flatmate@example.com", "Password123")
+
+	listTrash := func() models.TrashedLedgersResponse {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers/trash", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.TrashedLedgersResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	// Test case 1: Deleting moves the ledger to the trash
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var deleteResponse models.DeleteLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &deleteResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", deleteResponse.Status)
+	assert.True(t, deleteResponse.PurgeAt.After(time.Now()))
+
+	// Test case 2: The ledger is hidden from its members
+	for _, token := range []string{testCtx.TestUserJWT, flatmate.Token} {
+		w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(token))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/changes?fromSequence=1", nil, testutils.AuthHeaders(token))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = testutils.PerformRequest(testCtx.Router, http.MethodGet, "/api/ledgers", nil, testutils.AuthHeaders(token))
+		var listResponse models.ListLedgersResponse
+		err = json.Unmarshal(w.Body.Bytes(), &listResponse)
+		assert.NoError(t, err)
+		assert.Empty(t, listResponse.Ledgers)
+	}
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/changes",
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('late')"},
+		testutils.AuthHeaders(flatmate.Token),
+	)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 3: The owner sees it in their trash
+	trash := listTrash()
+	if assert.Len(t, trash.Ledgers, 1) {
+		assert.Equal(t, ledgerID, trash.Ledgers[0].ID)
+		assert.NotNil(t, trash.Ledgers[0].DeletedAt)
+		assert.WithinDuration(t, deleteResponse.PurgeAt, trash.Ledgers[0].PurgeAt, time.Second)
+	}
+
+	// Test case 4: A ledger in the trash can't be deleted again
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Test case 5: Only the owner can restore it
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/restore", nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/restore", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var restoreResponse models.RestoreLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &restoreResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, ledgerID, restoreResponse.Ledger.ID)
+	assert.Nil(t, restoreResponse.Ledger.DeletedAt)
+
+	// Members get their access back, and the history shows what happened
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/events", nil, testutils.AuthHeaders(flatmate.Token))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsResponse models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, eventsResponse.Events, 2) {
+		assert.Equal(t, models.LedgerEventTrashed, eventsResponse.Events[0].Type)
+		assert.Equal(t, models.LedgerEventRestored, eventsResponse.Events[1].Type)
+	}
+
+	assert.Empty(t, listTrash().Ledgers)
+
+	// Test case 6: Restoring a ledger that isn't in the trash is a conflict
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/restore", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 7: Once the retention period is over the ledger can't be restored and is purged
+	w = testutils.PerformRequest(testCtx.Router, http.MethodDelete, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, err = testCtx.DB.Exec(
+		`UPDATE ledgers SET deleted_at = $1 WHERE id = $2`,
+		time.Now().UTC().AddDate(-1, 0, 0), ledgerID)
+	assert.NoError(t, err)
+
+	assert.Empty(t, listTrash().Ledgers)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/restore", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	purged, err := testCtx.Service.PurgeTrashedLedgers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	ledger, err := testCtx.Repository.GetLedger(context.Background(), ledgerID)
+	assert.NoError(t, err)
+	assert.Nil(t, ledger)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, ledgerPath+"/restore", nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,170 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateLedger(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Trip", Description: "Summer trip", Currency: "USD"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var ledgerResponse models.LedgerResponse
+	err := json.Unmarshal(w.Body.Bytes(), &ledgerResponse)
+	assert.NoError(t, err)
+	ledgerID := ledgerResponse.LedgerID
+	ledgerPath := fmt.Sprintf("/api/ledgers/%s", ledgerID)
+
+	// Share the ledger with a writer and an admin
+	members := map[string]string{"writer@example.com": "write", "admin@example.com": "admin"}
+	tokens := map[string]string{}
+	for email, permissions := range members {
+		w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", models.SignUpRequest{
+			Email:    email,
+			Password: "Password123",
+			Name:     "Member",
+		}, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			ledgerPath+"/users",
+			models.AddUserToLedgerRequest{Email: email, Permissions: permissions},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		tokens[email] = testutils.Login(t, testCtx.Router, email, "Password123").Token
+	}
+
+	patchLedger := func(token, etag string, req models.UpdateLedgerRequest) *httptest.ResponseRecorder {
+		headers := testutils.AuthHeaders(token)
+		if etag != "" {
+			headers["If-Match"] = etag
+		}
+		return testutils.PerformRequest(testCtx.Router, http.MethodPatch, ledgerPath, req, headers)
+	}
+
+	strPtr := func(s string) *string { return &s }
+
+	// The details endpoint returns the ETag to update against
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Test case 1: Updates without If-Match are refused
+	w = patchLedger(testCtx.TestUserJWT, "", models.UpdateLedgerRequest{Name: strPtr("Europe Trip")})
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	// Test case 2: Updates based on another version are refused
+	w = patchLedger(testCtx.TestUserJWT, `"2000-01-01T00:00:00Z"`, models.UpdateLedgerRequest{Name: strPtr("Europe Trip")})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Test case 3: The owner renames the ledger and changes its currency
+	w = patchLedger(testCtx.TestUserJWT, etag, models.UpdateLedgerRequest{
+		Name:     strPtr("Europe Trip"),
+		Currency: strPtr("EUR"),
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updateResponse models.UpdateLedgerResponse
+	err = json.Unmarshal(w.Body.Bytes(), &updateResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", updateResponse.Status)
+	assert.Equal(t, "Europe Trip", updateResponse.Ledger.Name)
+	assert.Equal(t, "Summer trip", updateResponse.Ledger.Description)
+	assert.Equal(t, "EUR", updateResponse.Ledger.Currency)
+
+	newETag := w.Header().Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	// The new ETag matches what the details endpoint now returns
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath, nil, testutils.AuthHeaders(testCtx.TestUserJWT))
+	assert.Equal(t, newETag, w.Header().Get("ETag"))
+
+	var detailsResponse models.LedgerDetailsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &detailsResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe Trip", detailsResponse.Ledger.Name)
+
+	// Test case 4: The old ETag can't be used again
+	w = patchLedger(testCtx.TestUserJWT, etag, models.UpdateLedgerRequest{Name: strPtr("Stale Trip")})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Test case 5: Members with write access can't change the ledger itself
+	w = patchLedger(tokens["writer@example.com"], newETag, models.UpdateLedgerRequest{Name: strPtr("Writer Trip")})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 6: Admins can
+	w = patchLedger(tokens["admin@example.com"], newETag, models.UpdateLedgerRequest{Description: strPtr("Paris and Rome")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 7: Every member can see what changed
+	w = testutils.PerformRequest(testCtx.Router, http.MethodGet, ledgerPath+"/events", nil, testutils.AuthHeaders(tokens["writer@example.com"]))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var eventsResponse models.LedgerEventsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, eventsResponse.Events, 2) {
+		first := eventsResponse.Events[0]
+		assert.Equal(t, models.LedgerEventMetadataUpdated, first.Type)
+		assert.Equal(t, testCtx.TestUserID, *first.UserID)
+		assert.Equal(t, map[string]interface{}{"from": "Trip", "to": "Europe Trip"}, first.Details["name"])
+		assert.Equal(t, map[string]interface{}{"from": "USD", "to": "EUR"}, first.Details["currency"])
+		assert.NotContains(t, first.Details, "description")
+
+		second := eventsResponse.Events[1]
+		assert.Equal(t, map[string]interface{}{"from": "Summer trip", "to": "Paris and Rome"}, second.Details["description"])
+
+		// Only events after since are returned
+		w = testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodGet,
+			ledgerPath+"/events?since="+url.QueryEscape(first.CreatedAt.Format(time.RFC3339Nano)),
+			nil,
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		err = json.Unmarshal(w.Body.Bytes(), &eventsResponse)
+		assert.NoError(t, err)
+		if assert.Len(t, eventsResponse.Events, 1) {
+			assert.Equal(t, second.ID, eventsResponse.Events[0].ID)
+		}
+	}
+
+	// Test case 8: Only owners and admins can make other members admins
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		ledgerPath+"/users",
+		models.AddUserToLedgerRequest{Email: "writer@example.com", Permissions: "admin"},
+		testutils.AuthHeaders(tokens["writer@example.com"]),
+	)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 9: Invalid fields are rejected
+	w = patchLedger(testCtx.TestUserJWT, newETag, models.UpdateLedgerRequest{Name: strPtr("")})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
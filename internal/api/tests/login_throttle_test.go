@@ -0,0 +1,128 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockout(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ACCOUNT_FAILURES", "3")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	badLogin := models.LoginRequest{
+		Email:    "testuser@example.com",
+		Password: "wrongpassword",
+	}
+
+	// Test case 1: Failures below the limit are ordinary 401s
+	for i := 0; i < 2; i++ {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/login",
+			badLogin,
+			nil,
+		)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Test case 2: The failure that reaches the limit locks the account
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		badLogin,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 3: A locked account rejects even the correct password
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{Email: "testuser@example.com", Password: "testpassword"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "TOO_MANY_ATTEMPTS")
+
+	// Test case 4: The lock is per account, so other users can still log in
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		models.SignUpRequest{Email: "other@example.com", Password: "Password123", Name: "Other User"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	testutils.Login(t, testCtx.Router, "other@example.com", "Password123")
+
+	// Test case 5: Resetting the password unlocks the account
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/forgot",
+		models.ForgotPasswordRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: testCtx.MailLog.LastMailToken(), NewPassword: "newpassword123"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "newpassword123")
+}
+
+func TestLoginLockoutByIP(t *testing.T) {
+	t.Setenv("LOGIN_MAX_IP_FAILURES", "3")
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Failures against different accounts from one IP lock the IP, even when
+	// each request claims to come from somewhere else
+	for i := 0; i < 3; i++ {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/login",
+			models.LoginRequest{Email: fmt.Sprintf("victim%d@example.com", i), Password: "wrongpassword"},
+			map[string]string{"X-Forwarded-For": fmt.Sprintf("203.0.113.%d", i+1)},
+		)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Test case 2: A spoofed X-Forwarded-For doesn't get around the lock
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{Email: "testuser@example.com", Password: "testpassword"},
+		map[string]string{"X-Forwarded-For": "198.51.100.7"},
+	)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "TOO_MANY_ATTEMPTS")
+}
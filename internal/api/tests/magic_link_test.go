@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	t.Setenv("MAGIC_LINK_MAX_REQUESTS", "3")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Unknown email succeeds without sending anything
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "nobody@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, testCtx.MailLog.Messages())
+
+	// Test case 2: Known email receives a sign-in link
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	msg, ok := testCtx.MailLog.LastTo("testuser@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "Your sign-in link", msg.Subject)
+
+	firstToken := testCtx.MailLog.LastTokenTo("testuser@example.com")
+	assert.NotEmpty(t, firstToken)
+
+	// Test case 3: Requesting another link invalidates the first one
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	linkToken := testCtx.MailLog.LastTokenTo("testuser@example.com")
+	assert.NotEqual(t, firstToken, linkToken)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link/consume",
+		models.ConsumeMagicLinkRequest{Token: firstToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_TOKEN")
+
+	// Test case 4: The link signs the user in like a password login
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link/consume",
+		models.ConsumeMagicLinkRequest{
+			Token:      linkToken,
+			DeviceInfo: models.DeviceInfo{DeviceName: "Test Phone", Platform: "ios"},
+		},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, response.UserID)
+	assert.NotEmpty(t, response.Token)
+	assert.NotEmpty(t, response.RefreshToken)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(response.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Opening the link verified the address
+	var profile models.UserResponse
+	err = json.Unmarshal(w.Body.Bytes(), &profile)
+	assert.NoError(t, err)
+	assert.NotNil(t, profile.User.EmailVerifiedAt)
+
+	// Test case 5: Links are single-use
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link/consume",
+		models.ConsumeMagicLinkRequest{Token: linkToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 6: Requests are limited per address
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sent := len(testCtx.MailLog.Messages())
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "TestUser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Len(t, testCtx.MailLog.Messages(), sent)
+
+	// Test case 7: Other addresses are unaffected
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/magic-link",
+		models.MagicLinkRequest{Email: "nobody@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPTwoFactorLogin(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Start enrolment
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/mfa/totp/enroll",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var enrollment models.TOTPEnrollmentResponse
+	err := json.Unmarshal(w.Body.Bytes(), &enrollment)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/")
+
+	// Login is unaffected until enrolment is confirmed
+	session := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	assert.False(t, session.MFARequired)
+	assert.NotEmpty(t, session.Token)
+
+	// Test case 2: A wrong code doesn't confirm enrolment
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/mfa/totp/confirm",
+		models.ConfirmTOTPRequest{Code: "000000"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 3: Confirm enrolment and receive recovery codes
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	assert.NoError(t, err)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/mfa/totp/confirm",
+		models.ConfirmTOTPRequest{Code: code},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var recovery models.RecoveryCodesResponse
+	err = json.Unmarshal(w.Body.Bytes(), &recovery)
+	assert.NoError(t, err)
+	assert.Len(t, recovery.RecoveryCodes, 10)
+
+	// Test case 4: Password login now returns a challenge instead of tokens
+	challenge := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	assert.Equal(t, "mfa_required", challenge.Status)
+	assert.True(t, challenge.MFARequired)
+	assert.NotEmpty(t, challenge.MFAToken)
+	assert.Empty(t, challenge.Token)
+	assert.Empty(t, challenge.RefreshToken)
+
+	// Test case 5: The challenge token is not an access token
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/ledgers/any-ledger/sequence",
+		nil,
+		testutils.AuthHeaders(challenge.MFAToken),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 6: The code used for confirmation can't be replayed
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login/mfa",
+		models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: code},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 7: The next code completes the login
+	nextCode, err := totp.Code(enrollment.Secret, time.Now().Add(totp.Period*time.Second))
+	assert.NoError(t, err)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login/mfa",
+		models.MFALoginRequest{MFAToken: challenge.MFAToken, Code: nextCode},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var mfaResponse models.AuthResponse
+	err = json.Unmarshal(w.Body.Bytes(), &mfaResponse)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, mfaResponse.Token)
+	assert.NotEmpty(t, mfaResponse.RefreshToken)
+
+	// Test case 8: A recovery code works exactly once
+	recoveryLogin := models.MFALoginRequest{
+		MFAToken:     challenge.MFAToken,
+		RecoveryCode: recovery.RecoveryCodes[0],
+	}
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/login/mfa", recoveryLogin, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/login/mfa", recoveryLogin, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 9: Disabling requires the password and a second factor
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/mfa/totp/disable",
+		models.DisableTOTPRequest{Password: "wrongpassword", RecoveryCode: recovery.RecoveryCodes[1]},
+		testutils.AuthHeaders(mfaResponse.Token),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/mfa/totp/disable",
+		models.DisableTOTPRequest{Password: "testpassword", RecoveryCode: recovery.RecoveryCodes[1]},
+		testutils.AuthHeaders(mfaResponse.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Password login issues tokens directly again
+	session = testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	assert.False(t, session.MFARequired)
+	assert.NotEmpty(t, session.Token)
+}
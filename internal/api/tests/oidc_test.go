@@ -0,0 +1,202 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// startOIDCLogin starts a login with the provider and returns the authorization URL and state
+func startOIDCLogin(t *testing.T, testCtx *testutils.TestContext, provider string) models.OIDCStartResponse {
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/"+provider+"/start",
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.OIDCStartResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, response.AuthorizationURL)
+	assert.NotEmpty(t, response.State)
+
+	return response
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := testutils.NewMockOIDCProvider(t)
+	mock.Configure(t, "mock")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	identity := testutils.MockIdentity{
+		Subject:       "mock-subject-1",
+		Email:         "social@example.com",
+		EmailVerified: true,
+		Name:          "Social User",
+	}
+
+	// Test case 1: First login creates a verified user
+	start := startOIDCLogin(t, testCtx, "mock")
+	code := mock.Authorize(t, start.AuthorizationURL, identity)
+
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: code, State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var firstLogin models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &firstLogin)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, firstLogin.Token)
+	assert.NotEmpty(t, firstLogin.RefreshToken)
+
+	user, err := testCtx.Repository.GetUserByEmail(context.Background(), "social@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, firstLogin.UserID, user.ID)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Social Ledger", Currency: "USD"},
+		testutils.AuthHeaders(firstLogin.Token),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 2: The state can only be used once
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: code, State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 3: Logging in again finds the linked user
+	start = startOIDCLogin(t, testCtx, "mock")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: mock.Authorize(t, start.AuthorizationURL, identity), State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var secondLogin models.AuthResponse
+	err = json.Unmarshal(w.Body.Bytes(), &secondLogin)
+	assert.NoError(t, err)
+	assert.Equal(t, firstLogin.UserID, secondLogin.UserID)
+
+	// Test case 4: A code that the provider doesn't recognise is rejected
+	start = startOIDCLogin(t, testCtx, "mock")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: "forged-code", State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 5: Unknown provider
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/unknown/start",
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOIDCAccountLinking(t *testing.T) {
+	mock := testutils.NewMockOIDCProvider(t)
+	mock.Configure(t, "mock")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	identity := testutils.MockIdentity{
+		Subject:       "mock-subject-2",
+		Email:         "testuser@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+	}
+
+	// Test case 1: An existing account that never verified its email is not linked
+	start := startOIDCLogin(t, testCtx, "mock")
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: mock.Authorize(t, start.AuthorizationURL, identity), State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 2: Once verified, the provider account is linked to the existing user
+	_, err := testCtx.Repository.MarkEmailVerified(context.Background(), testCtx.TestUserID, "testuser@example.com")
+	assert.NoError(t, err)
+
+	start = startOIDCLogin(t, testCtx, "mock")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{Code: mock.Authorize(t, start.AuthorizationURL, identity), State: start.State},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, response.UserID)
+
+	// The password still works for the linked account
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 3: New accounts need an email the provider has verified
+	start = startOIDCLogin(t, testCtx, "mock")
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/oidc/mock/callback",
+		models.OIDCCallbackRequest{
+			Code: mock.Authorize(t, start.AuthorizationURL, testutils.MockIdentity{
+				Subject: "mock-subject-3",
+				Email:   "unverified-social@example.com",
+			}),
+			State: start.State,
+		},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
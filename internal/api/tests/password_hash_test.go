@@ -0,0 +1,69 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHashUpgrade(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	ctx := context.Background()
+
+	// Test case 1: The test user starts with a bcrypt hash
+	user, err := testCtx.Repository.GetUserByID(ctx, testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"))
+
+	// Test case 2: A wrong password leaves the hash alone
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{Email: "testuser@example.com", Password: "wrongpassword"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	user, err = testCtx.Repository.GetUserByID(ctx, testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"))
+
+	// Test case 3: A successful login rehashes with argon2id
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	user, err = testCtx.Repository.GetUserByID(ctx, testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$v=19$"))
+
+	// Test case 4: The upgraded hash keeps working and isn't rehashed again
+	upgraded := user.Password
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	user, err = testCtx.Repository.GetUserByID(ctx, testCtx.TestUserID)
+	assert.NoError(t, err)
+	assert.Equal(t, upgraded, user.Password)
+
+	// Test case 5: New accounts are hashed with argon2id from the start
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/signup",
+		models.SignUpRequest{Email: "argon@example.com", Password: "Password123", Name: "Argon User"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	user, err = testCtx.Repository.GetUserByEmail(ctx, "argon@example.com")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// policyViolations decodes a WEAK_PASSWORD response into the list of failed rules
+func policyViolations(t *testing.T, body []byte) []string {
+	var response models.PasswordPolicyErrorResponse
+	err := json.Unmarshal(body, &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "WEAK_PASSWORD", response.Code)
+
+	var rules []string
+	for _, violation := range response.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	// One plaintext entry and one SHA-1 entry ("Summer2024!") with a breach count
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	err := os.WriteFile(blocklist, []byte("# common passwords\nqwertyuiop\n7E8B0A3433F1210A9699D85420E363A1B162ECAC:1204\n"), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", blocklist)
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	signup := func(password string) *models.SignUpRequest {
+		return &models.SignUpRequest{Email: "policy.user@example.com", Password: password, Name: "Policy Tester"}
+	}
+
+	// Test case 1: Every failed rule is reported
+	w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("short"), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"min_length"}, policyViolations(t, w.Body.Bytes()))
+
+	// Test case 2: Passwords containing the email or name
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("my-Policy.User-pass"), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"contains_email", "contains_name"}, policyViolations(t, w.Body.Bytes()))
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("TESTER-forever"), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"contains_name"}, policyViolations(t, w.Body.Bytes()))
+
+	// Test case 3: Passwords on the blocklist, as plaintext or as a SHA-1 hash
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("qwertyuiop"), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"breached"}, policyViolations(t, w.Body.Bytes()))
+
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("Summer2024!"), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"breached"}, policyViolations(t, w.Body.Bytes()))
+
+	// Test case 4: A good password is accepted
+	w = testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/signup", signup("correct horse battery"), nil)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Test case 5: Password changes follow the same policy
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/password",
+		models.ChangePasswordRequest{CurrentPassword: "testpassword", NewPassword: "qwertyuiop"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"breached"}, policyViolations(t, w.Body.Bytes()))
+
+	// Test case 6: A rejected reset doesn't use up the link
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/forgot",
+		models.ForgotPasswordRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	resetToken := testCtx.MailLog.LastMailToken()
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: resetToken, NewPassword: "testuser-2024"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"contains_email", "contains_name"}, policyViolations(t, w.Body.Bytes()))
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: resetToken, NewPassword: "newpassword123"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordReset(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	session := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 1: Unknown email succeeds without sending anything
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/forgot",
+		models.ForgotPasswordRequest{Email: "nobody@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, testCtx.MailLog.LastMailToken())
+
+	// Test case 2: Known email receives a reset link
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/forgot",
+		models.ForgotPasswordRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, testCtx.MailLog.String(), "To: testuser@example.com")
+
+	firstToken := testCtx.MailLog.LastMailToken()
+	assert.NotEmpty(t, firstToken)
+
+	// Test case 3: Requesting another link invalidates the first one
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/forgot",
+		models.ForgotPasswordRequest{Email: "testuser@example.com"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resetToken := testCtx.MailLog.LastMailToken()
+	assert.NotEqual(t, firstToken, resetToken)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: firstToken, NewPassword: "newpassword123"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 4: Successful reset
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: resetToken, NewPassword: "newpassword123"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 5: The token can only be used once
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: resetToken, NewPassword: "anotherpassword"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Test case 6: Existing sessions were signed out
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: session.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 7: Only the new password works
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{Email: "testuser@example.com", Password: "testpassword"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "newpassword123")
+
+	// Test case 8: Password too short
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/password/reset",
+		models.ResetPasswordRequest{Token: "whatever", NewPassword: "short"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
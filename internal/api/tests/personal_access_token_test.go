@@ -0,0 +1,207 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Create two ledgers; tokens will only be scoped to the first
+	var ledgerIDs []string
+	for _, name := range []string{"Scoped Ledger", "Other Ledger"} {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/ledgers",
+			models.CreateLedgerRequest{Name: name, Currency: "USD"},
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.LedgerResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		ledgerIDs = append(ledgerIDs, response.LedgerID)
+	}
+	scopedLedger, otherLedger := ledgerIDs[0], ledgerIDs[1]
+
+	// Test case 1: Create a read-only token
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/tokens",
+		models.CreatePersonalAccessTokenRequest{
+			Name:       "Import script",
+			Permission: "read",
+			LedgerIDs:  []string{scopedLedger},
+		},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var readToken models.CreatePersonalAccessTokenResponse
+	err := json.Unmarshal(w.Body.Bytes(), &readToken)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(readToken.Token, "pat_"))
+	assert.Equal(t, []string{scopedLedger}, readToken.AccessToken.LedgerIDs)
+
+	// Test case 2: The token can read its ledger
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/ledgers/"+scopedLedger+"/sequence",
+		nil,
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 3: A read-only token can't write, even though the user can
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers/"+scopedLedger+"/changes",
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('pat_entry')"},
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 4: Ledgers outside the scope are off limits
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/ledgers/"+otherLedger+"/sequence",
+		nil,
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 5: Tokens can't create ledgers or manage the account
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Token Ledger", Currency: "USD"},
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/auth/tokens",
+		nil,
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 6: A write token can submit changes
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/tokens",
+		models.CreatePersonalAccessTokenRequest{
+			Name:          "Sync job",
+			Permission:    "write",
+			LedgerIDs:     []string{scopedLedger},
+			ExpiresInDays: 30,
+		},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var writeToken models.CreatePersonalAccessTokenResponse
+	err = json.Unmarshal(w.Body.Bytes(), &writeToken)
+	assert.NoError(t, err)
+	assert.NotNil(t, writeToken.AccessToken.ExpiresAt)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers/"+scopedLedger+"/changes",
+		models.LedgerChangeRequest{SQLStatement: "INSERT INTO entries (id) VALUES ('pat_entry')"},
+		testutils.AuthHeaders(writeToken.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 7: Tokens can't be scoped to ledgers the user can't access
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/tokens",
+		models.CreatePersonalAccessTokenRequest{
+			Name:       "Too broad",
+			Permission: "read",
+			LedgerIDs:  []string{"non-existent-id"},
+		},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 8: Listing shows both tokens without their values
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/auth/tokens",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), readToken.Token)
+
+	var list models.ListPersonalAccessTokensResponse
+	err = json.Unmarshal(w.Body.Bytes(), &list)
+	assert.NoError(t, err)
+	assert.Len(t, list.Tokens, 2)
+
+	// Test case 9: Revoked tokens stop working
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/auth/tokens/"+readToken.AccessToken.ID,
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/ledgers/"+scopedLedger+"/sequence",
+		nil,
+		testutils.AuthHeaders(readToken.Token),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 10: Revoking twice
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/auth/tokens/"+readToken.AccessToken.ID,
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,221 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: Get the profile
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "password")
+
+	var response models.UserResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, response.User.ID)
+	assert.Equal(t, "testuser@example.com", response.User.Email)
+
+	// Test case 2: Update the name
+	name := "Renamed User"
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPatch,
+		"/api/users/me",
+		models.UpdateProfileRequest{Name: &name},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed User", response.User.Name)
+
+	// Test case 3: An empty name is rejected
+	empty := ""
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPatch,
+		"/api/users/me",
+		models.UpdateProfileRequest{Name: &empty},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestChangePassword(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	current := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+	other := testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 1: Wrong current password
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/password",
+		models.ChangePasswordRequest{CurrentPassword: "wrongpassword", NewPassword: "newpassword123"},
+		testutils.AuthHeaders(current.Token),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 2: Successful change
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/password",
+		models.ChangePasswordRequest{CurrentPassword: "testpassword", NewPassword: "newpassword123"},
+		testutils.AuthHeaders(current.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 3: The session that changed the password stays signed in
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(current.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 4: Other sessions are signed out
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(other.Token),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: other.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 5: Only the new password works
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{Email: "testuser@example.com", Password: "testpassword"},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "newpassword123")
+}
+
+func TestChangeEmail(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	// Test case 1: The new address can't belong to another account
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "testuser@example.com", CurrentPassword: "testpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 2: Wrong current password
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "changed@example.com", CurrentPassword: "wrongpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Test case 3: The confirmation link goes to the new address
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/users/me/email",
+		models.ChangeEmailRequest{NewEmail: "changed@example.com", CurrentPassword: "testpassword"},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, testCtx.MailLog.String(), "To: changed@example.com")
+
+	token := testCtx.MailLog.LastMailToken()
+	assert.NotEmpty(t, token)
+
+	// The old address keeps working until the change is confirmed
+	testutils.Login(t, testCtx.Router, "testuser@example.com", "testpassword")
+
+	// Test case 4: Confirming switches the account to the new, verified address
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/email/confirm",
+		models.ConfirmEmailChangeRequest{Token: token},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, testCtx.MailLog.String(), "To: testuser@example.com")
+
+	login := testutils.Login(t, testCtx.Router, "changed@example.com", "testpassword")
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(login.Token),
+	)
+
+	var response models.UserResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed@example.com", response.User.Email)
+	assert.NotNil(t, response.User.EmailVerifiedAt)
+
+	// Test case 5: The link can only be used once
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/email/confirm",
+		models.ConfirmEmailChangeRequest{Token: token},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
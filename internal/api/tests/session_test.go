@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginFromDevice logs in as the test user from the named device
+func loginFromDevice(t *testing.T, testCtx *testutils.TestContext, deviceName, platform string) models.AuthResponse {
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/login",
+		models.LoginRequest{
+			Email:    "testuser@example.com",
+			Password: "testpassword",
+			DeviceInfo: models.DeviceInfo{
+				DeviceName: deviceName,
+				Platform:   platform,
+				AppVersion: "1.4.0",
+			},
+		},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	return response
+}
+
+func TestSessions(t *testing.T) {
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	phone := loginFromDevice(t, testCtx, "Test Phone", "android")
+	web := loginFromDevice(t, testCtx, "Chrome", "web")
+
+	// Test case 1: Both devices are listed and the caller's own session is marked
+	w := testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me/sessions",
+		nil,
+		testutils.AuthHeaders(web.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list models.SessionsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &list)
+	assert.NoError(t, err)
+	assert.Len(t, list.Sessions, 2)
+
+	var phoneSessionID string
+	for _, session := range list.Sessions {
+		assert.Equal(t, "1.4.0", session.AppVersion)
+		assert.Equal(t, session.DeviceName == "Chrome", session.Current)
+		if session.DeviceName == "Test Phone" {
+			assert.Equal(t, "android", session.Platform)
+			phoneSessionID = session.ID
+		}
+	}
+	assert.NotEmpty(t, phoneSessionID)
+
+	// Test case 2: Revoke the phone from the web session
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/users/me/sessions/"+phoneSessionID,
+		nil,
+		testutils.AuthHeaders(web.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 3: The phone's access and refresh tokens stop working
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/ledgers",
+		models.CreateLedgerRequest{Name: "Lost Phone Ledger", Currency: "USD"},
+		testutils.AuthHeaders(phone.Token),
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/refresh",
+		models.RefreshTokenRequest{RefreshToken: phone.RefreshToken},
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 4: The web session is unaffected and the phone is no longer listed
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me/sessions",
+		nil,
+		testutils.AuthHeaders(web.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &list)
+	assert.NoError(t, err)
+	assert.Len(t, list.Sessions, 1)
+
+	// Test case 5: Revoking twice
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/users/me/sessions/"+phoneSessionID,
+		nil,
+		testutils.AuthHeaders(web.Token),
+	)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Test case 6: Unauthorized request (no token)
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me/sessions",
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
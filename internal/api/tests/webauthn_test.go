@@ -0,0 +1,198 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/api/testutils"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebAuthnPasskeys(t *testing.T) {
+	t.Setenv("WEBAUTHN_RP_ID", "localhost")
+	t.Setenv("WEBAUTHN_ORIGINS", "http://localhost:8080")
+
+	testCtx := testutils.SetupTestContext(t)
+	defer testutils.CleanupTestContext(testCtx)
+
+	authenticator := testutils.NewSoftAuthenticator(t, "http://localhost:8080")
+
+	startRegistration := func() models.WebAuthnRegistrationOptions {
+		w := testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/webauthn/register/start",
+			nil,
+			testutils.AuthHeaders(testCtx.TestUserJWT),
+		)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WebAuthnRegistrationStartResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.PublicKey
+	}
+
+	startLogin := func() models.WebAuthnLoginOptions {
+		w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/webauthn/login/start", nil, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WebAuthnLoginStartResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.PublicKey
+	}
+
+	finishLogin := func(credential models.WebAuthnAssertionCredential) *httptest.ResponseRecorder {
+		return testutils.PerformRequest(
+			testCtx.Router,
+			http.MethodPost,
+			"/api/auth/webauthn/login/finish",
+			models.FinishWebAuthnLoginRequest{Credential: credential},
+			nil,
+		)
+	}
+
+	// Test case 1: Registration requires a login session
+	w := testutils.PerformRequest(testCtx.Router, http.MethodPost, "/api/auth/webauthn/register/start", nil, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 2: Register a passkey
+	options := startRegistration()
+	assert.NotEmpty(t, options.Challenge)
+	assert.Equal(t, "localhost", options.RP.ID)
+	assert.Equal(t, "testuser@example.com", options.User.Name)
+	assert.Empty(t, options.ExcludeCredentials)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/webauthn/register/finish",
+		models.FinishWebAuthnRegistrationRequest{
+			Name:       "Test Phone",
+			Credential: authenticator.Register(t, options),
+		},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var registered models.WebAuthnCredentialResponse
+	err := json.Unmarshal(w.Body.Bytes(), &registered)
+	assert.NoError(t, err)
+	assert.Equal(t, authenticator.ID(), registered.Credential.CredentialID)
+	assert.Equal(t, "Test Phone", registered.Credential.Name)
+
+	// Test case 3: The same authenticator can't be registered twice
+	options = startRegistration()
+	assert.Equal(t, []models.WebAuthnCredentialDescriptor{{Type: "public-key", ID: authenticator.ID()}}, options.ExcludeCredentials)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodPost,
+		"/api/auth/webauthn/register/finish",
+		models.FinishWebAuthnRegistrationRequest{Credential: authenticator.Register(t, options)},
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Test case 4: Sign in with the passkey
+	assertion := authenticator.Login(t, startLogin())
+
+	w = finishLogin(assertion)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.AuthResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, response.UserID)
+	assert.NotEmpty(t, response.RefreshToken)
+
+	// The access token is the same kind a password login issues
+	claims, err := testCtx.Service.ParseToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, testCtx.TestUserID, claims["sub"])
+	assert.Equal(t, "access", claims["typ"])
+	assert.NotEmpty(t, claims["sid"])
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/users/me",
+		nil,
+		testutils.AuthHeaders(response.Token),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Test case 5: Challenges are single-use, so an assertion can't be replayed
+	w = finishLogin(assertion)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_TOKEN")
+
+	// Test case 6: Assertions from another origin are rejected
+	authenticator.Origin = "https://phishing.example"
+	w = finishLogin(authenticator.Login(t, startLogin()))
+	authenticator.Origin = "http://localhost:8080"
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Test case 7: A sign count that didn't increase points to a cloned passkey
+	authenticator.SignCount = 0
+	w = finishLogin(authenticator.Login(t, startLogin()))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "sign count")
+
+	// Test case 8: List the user's passkeys
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodGet,
+		"/api/auth/webauthn/credentials",
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list models.WebAuthnCredentialsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &list)
+	assert.NoError(t, err)
+	assert.Len(t, list.Credentials, 1)
+	assert.NotNil(t, list.Credentials[0].LastUsedAt)
+
+	// Test case 9: Deleted passkeys can't sign in
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/auth/webauthn/credentials/"+registered.Credential.ID,
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	authenticator.SignCount = 100
+	w = finishLogin(authenticator.Login(t, startLogin()))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = testutils.PerformRequest(
+		testCtx.Router,
+		http.MethodDelete,
+		"/api/auth/webauthn/credentials/"+registered.Credential.ID,
+		nil,
+		testutils.AuthHeaders(testCtx.TestUserJWT),
+	)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
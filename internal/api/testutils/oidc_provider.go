@@ -0,0 +1,192 @@
+package testutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockIdentity is the account a MockOIDCProvider signs in as
+type MockIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// MockOIDCProvider is a local OpenID Connect issuer that approves every authorization request
+type MockOIDCProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	identity      MockIdentity
+	nonce         string
+	codeChallenge string
+}
+
+// NewMockOIDCProvider starts a mock issuer that is shut down when the test ends
+func NewMockOIDCProvider(t *testing.T) *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "Failed to generate mock OIDC key")
+
+	m := &MockOIDCProvider{
+		ClientID:     "mock-client",
+		ClientSecret: "mock-secret",
+		RedirectURL:  "billapp://oidc/callback",
+		key:          key,
+		codes:        make(map[string]mockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.handleDiscovery)
+	mux.HandleFunc("/jwks", m.handleJWKS)
+	mux.HandleFunc("/token", m.handleToken)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Server.Close)
+
+	return m
+}
+
+// Configure points the server configuration at the mock issuer under the given provider name.
+// Call it before SetupTestContext.
+func (m *MockOIDCProvider) Configure(t *testing.T, name string) {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	t.Setenv("OIDC_PROVIDERS", name)
+	t.Setenv(prefix+"ISSUER", m.Server.URL)
+	t.Setenv(prefix+"CLIENT_ID", m.ClientID)
+	t.Setenv(prefix+"CLIENT_SECRET", m.ClientSecret)
+	t.Setenv(prefix+"REDIRECT_URL", m.RedirectURL)
+}
+
+// Authorize plays the user approving the login at the provider. It checks the authorization
+// URL the server built and returns the code the provider would redirect back with.
+func (m *MockOIDCProvider) Authorize(t *testing.T, authorizationURL string, identity MockIdentity) string {
+	u, err := url.Parse(authorizationURL)
+	assert.NoError(t, err)
+
+	params := u.Query()
+	assert.Equal(t, "code", params.Get("response_type"))
+	assert.Equal(t, m.ClientID, params.Get("client_id"))
+	assert.Equal(t, m.RedirectURL, params.Get("redirect_uri"))
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+	assert.NotEmpty(t, params.Get("code_challenge"))
+	assert.NotEmpty(t, params.Get("nonce"))
+
+	code := uuid.New().String()
+
+	m.mu.Lock()
+	m.codes[code] = mockAuthorization{
+		identity:      identity,
+		nonce:         params.Get("nonce"),
+		codeChallenge: params.Get("code_challenge"),
+	}
+	m.mu.Unlock()
+
+	return code
+}
+
+func (m *MockOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 m.Server.URL,
+		"authorization_endpoint": m.Server.URL + "/authorize",
+		"token_endpoint":         m.Server.URL + "/token",
+		"jwks_uri":               m.Server.URL + "/jwks",
+	})
+}
+
+func (m *MockOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *MockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	if r.PostForm.Get("client_id") != m.ClientID || r.PostForm.Get("client_secret") != m.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use
+	m.mu.Lock()
+	auth, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || r.PostForm.Get("redirect_uri") != m.RedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.Server.URL,
+		"aud":            m.ClientID,
+		"sub":            auth.identity.Subject,
+		"email":          auth.identity.Email,
+		"email_verified": auth.identity.EmailVerified,
+		"name":           auth.identity.Name,
+		"nonce":          auth.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "mock-key"
+
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": uuid.New().String(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,7 +18,10 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/rongwang/COMP90018-server/internal/api"
 	"github.com/rongwang/COMP90018-server/internal/config"
+	"github.com/rongwang/COMP90018-server/internal/keyset"
+	"github.com/rongwang/COMP90018-server/internal/mailer"
 	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/password"
 	"github.com/rongwang/COMP90018-server/internal/repository"
 	"github.com/rongwang/COMP90018-server/internal/service"
 	"github.com/stretchr/testify/assert"
@@ -28,8 +33,9 @@ type TestContext struct {
 	Router      *gin.Engine
 	Repository  repository.Repository
 	Service     service.Service
-	JWTSecret   []byte
+	Keys        *keyset.KeySet
 	DB          *sqlx.DB
+	MailLog     *Mailbox // Every email sent by the service
 	TestUserID  string
 	TestUserJWT string
 }
@@ -59,8 +65,18 @@ func SetupTestContext(t *testing.T) *TestContext {
 	// Create repository
 	repo := repository.NewPostgresRepository(db)
 
+	// Capture outgoing email
+	mailLog := &Mailbox{MemoryMailer: mailer.NewMemoryMailer()}
+
+	// Load the JWT keys (HMAC unless the test sets JWT_KEYS_DIR)
+	keys, err := keyset.New(cfg.Auth)
+	assert.NoError(t, err, "Failed to load JWT keys")
+
+	passwords, err := password.New(cfg.Auth.Password)
+	assert.NoError(t, err, "Failed to set up password hashing")
+
 	// Create service
-	svc := service.NewDefaultService(repo, cfg.Auth.JWTSecret)
+	svc := service.NewDefaultService(repo, cfg, mailLog, keys, passwords)
 
 	// Create API handler
 	handler := api.NewHandler(svc)
@@ -68,25 +84,22 @@ func SetupTestContext(t *testing.T) *TestContext {
 	// Set up Gin router
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-
-	// Add middleware for JWT secret
-	router.Use(func(c *gin.Context) {
-		c.Set("jwtSecret", []byte(cfg.Auth.JWTSecret))
-		c.Next()
-	})
+	err = router.SetTrustedProxies(cfg.Server.TrustedProxies)
+	assert.NoError(t, err, "Failed to set trusted proxies")
 
 	// Set up routes
 	handler.SetupRoutes(router)
 
 	// Create test user if needed
-	testUserID, token := createTestUser(t, repo, cfg.Auth.JWTSecret)
+	testUserID, token := createTestUser(t, repo, keys)
 
 	return &TestContext{
 		Router:      router,
 		Repository:  repo,
 		Service:     svc,
-		JWTSecret:   []byte(cfg.Auth.JWTSecret),
+		Keys:        keys,
 		DB:          db,
+		MailLog:     mailLog,
 		TestUserID:  testUserID,
 		TestUserJWT: token,
 	}
@@ -125,6 +138,18 @@ func cleanupTestDatabase(t *testing.T, repo repository.Repository) {
 			t.Logf("Warning: Failed to clean ledgers: %v", err)
 		}
 
+		// Delete all rate limit counters
+		_, err = db.Exec("DELETE FROM rate_limits")
+		if t != nil && err != nil {
+			t.Logf("Warning: Failed to clean rate_limits: %v", err)
+		}
+
+		// Delete all login throttles, which aren't tied to users
+		_, err = db.Exec("DELETE FROM login_throttles")
+		if t != nil && err != nil {
+			t.Logf("Warning: Failed to clean login_throttles: %v", err)
+		}
+
 		// Delete all users
 		_, err = db.Exec("DELETE FROM users")
 		if t != nil && err != nil {
@@ -134,10 +159,11 @@ func cleanupTestDatabase(t *testing.T, repo repository.Repository) {
 }
 
 // Helper functions
-func createTestUser(t *testing.T, repo repository.Repository, jwtSecret string) (string, string) {
+func createTestUser(t *testing.T, repo repository.Repository, keys *keyset.KeySet) (string, string) {
 	// Clean up any existing test users first
 	cleanupTestDatabase(t, repo)
 
+	// Stored as bcrypt like accounts created before argon2id, so logins exercise the hash upgrade
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("testpassword"), bcrypt.DefaultCost)
 
 	user := &models.User{
@@ -152,14 +178,12 @@ func createTestUser(t *testing.T, repo repository.Repository, jwtSecret string)
 	err := repo.CreateUser(context.Background(), user)
 	assert.NoError(t, err, "Failed to create test user")
 
-	// Generate JWT token with the provided secret key
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	// Generate JWT token with the current signing key
+	tokenString, err := keys.Sign(jwt.MapClaims{
 		"sub": user.ID,
 		"exp": time.Now().Add(24 * time.Hour).Unix(),
 		"iat": time.Now().Unix(),
 	})
-
-	tokenString, err := token.SignedString([]byte(jwtSecret))
 	assert.NoError(t, err, "Failed to generate JWT token")
 
 	return user.ID, tokenString
@@ -179,6 +203,9 @@ func PerformRequest(r http.Handler, method, path string, body interface{}, heade
 	req, _ := http.NewRequest(method, path, reqBody)
 	req.Header.Set("Content-Type", "application/json")
 
+	// Every request comes from the same client, like httptest.NewRequest
+	req.RemoteAddr = "192.0.2.1:1234"
+
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
@@ -194,3 +221,56 @@ func AuthHeaders(token string) map[string]string {
 		"Authorization": fmt.Sprintf("Bearer %s", token),
 	}
 }
+
+// Login logs in through the API and returns the decoded response
+func Login(t *testing.T, r http.Handler, email, password string) models.AuthResponse {
+	w := PerformRequest(r, http.MethodPost, "/api/auth/login", models.LoginRequest{
+		Email:    email,
+		Password: password,
+	}, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "Failed to log in as %s", email)
+
+	var response models.AuthResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err, "Failed to decode login response")
+
+	return response
+}
+
+// Mailbox captures the emails sent by the service in memory
+type Mailbox struct {
+	*mailer.MemoryMailer
+}
+
+// String renders every captured email with its recipient and subject, oldest first
+func (b *Mailbox) String() string {
+	var s strings.Builder
+	for _, msg := range b.Messages() {
+		fmt.Fprintf(&s, "To: %s\nSubject: %s\n\n%s\n----\n", msg.To, msg.Subject, msg.Body)
+	}
+	return s.String()
+}
+
+// LastMailToken returns the token query parameter of the last link sent in an email
+func (b *Mailbox) LastMailToken() string {
+	return lastToken(b.String())
+}
+
+// LastTokenTo returns the token query parameter of the last link sent to the address
+func (b *Mailbox) LastTokenTo(to string) string {
+	msg, ok := b.LastTo(to)
+	if !ok {
+		return ""
+	}
+	return lastToken(msg.Body)
+}
+
+func lastToken(text string) string {
+	matches := mailTokenPattern.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
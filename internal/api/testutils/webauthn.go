@@ -0,0 +1,185 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// SoftAuthenticator is a software WebAuthn authenticator holding one ES256 passkey,
+// so tests can run registration and login ceremonies without a device
+type SoftAuthenticator struct {
+	Origin       string // Origin the "browser" reports in client data
+	RPID         string
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32 // Incremented before every assertion
+	UserVerified bool
+	key          *ecdsa.PrivateKey
+}
+
+// NewSoftAuthenticator creates an authenticator with a fresh key pair
+func NewSoftAuthenticator(t *testing.T, origin string) *SoftAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "Failed to generate passkey")
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	assert.NoError(t, err, "Failed to generate credential ID")
+
+	return &SoftAuthenticator{
+		Origin:       origin,
+		CredentialID: credentialID,
+		UserVerified: true,
+		key:          key,
+	}
+}
+
+// ID returns the credential ID as the browser reports it
+func (a *SoftAuthenticator) ID() string {
+	return base64.RawURLEncoding.EncodeToString(a.CredentialID)
+}
+
+// Register answers navigator.credentials.create() with "none" attestation
+func (a *SoftAuthenticator) Register(t *testing.T, options models.WebAuthnRegistrationOptions) models.WebAuthnAttestationCredential {
+	a.RPID = options.RP.ID
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.User.ID)
+	assert.NoError(t, err, "Invalid user handle")
+	a.UserHandle = userHandle
+
+	// COSE_Key of the public key
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	coseKey := cborMap(
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(-7), // alg: ES256
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+
+	// Attested credential data: AAGUID, credential ID length, credential ID, public key
+	attested := make([]byte, 16, 18+len(a.CredentialID)+len(coseKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.CredentialID)))
+	attested = append(attested, a.CredentialID...)
+	attested = append(attested, coseKey...)
+
+	authData := a.authenticatorData(0x40, attested)
+	attestationObject := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+
+	return models.WebAuthnAttestationCredential{
+		ID:   a.ID(),
+		Type: "public-key",
+		Response: models.WebAuthnAttestationResponse{
+			ClientDataJSON:    encode(a.clientData(t, "webauthn.create", options.Challenge)),
+			AttestationObject: encode(attestationObject),
+		},
+	}
+}
+
+// Login answers navigator.credentials.get() with a signed assertion
+func (a *SoftAuthenticator) Login(t *testing.T, options models.WebAuthnLoginOptions) models.WebAuthnAssertionCredential {
+	a.SignCount++
+
+	authData := a.authenticatorData(0, nil)
+	clientData := a.clientData(t, "webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	assert.NoError(t, err, "Failed to sign assertion")
+
+	return models.WebAuthnAssertionCredential{
+		ID:   a.ID(),
+		Type: "public-key",
+		Response: models.WebAuthnAssertionResponse{
+			ClientDataJSON:    encode(clientData),
+			AuthenticatorData: encode(authData),
+			Signature:         encode(signature),
+			UserHandle:        encode(a.UserHandle),
+		},
+	}
+}
+
+func (a *SoftAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	assert.NoError(t, err, "Failed to encode client data")
+	return clientData
+}
+
+// authenticatorData builds the RP ID hash, flags and sign count, followed by extra data
+func (a *SoftAuthenticator) authenticatorData(flags byte, extra []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+
+	flags |= 0x01 // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+
+	authData := append(rpIDHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.SignCount)
+	return append(authData, extra...)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Minimal CBOR encoding, enough for attestation objects and COSE keys
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes alternating keys and values
+func cborMap(items ...[]byte) []byte {
+	m := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		m = append(m, item...)
+	}
+	return m
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the application
@@ -11,11 +13,17 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Auth     AuthConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
+	WebAuthn WebAuthnConfig
+	Ledger   LedgerConfig
 }
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
-	Port int
+	Port           int
+	PublicURL      string   // Base URL used to build links sent to users
+	TrustedProxies []string // Proxies whose X-Forwarded-For header is believed, none if empty
 }
 
 // DatabaseConfig holds the database configuration
@@ -31,7 +39,84 @@ type DatabaseConfig struct {
 
 // AuthConfig holds the authentication configuration
 type AuthConfig struct {
-	JWTSecret string
+	JWTSecret              string        // HS256 secret, used when JWTKeysDir is empty
+	JWTKeysDir             string        // Directory of PEM keys for RS256/EdDSA signing
+	JWTSigningKeyID        string        // Key in JWTKeysDir that signs new tokens, newest if empty
+	AccessTokenTTL         time.Duration // Lifetime of the JWT access token
+	RefreshTokenTTL        time.Duration // Lifetime of a refresh token before it must be rotated
+	PasswordResetTTL       time.Duration // Lifetime of a password reset token
+	EmailVerificationTTL   time.Duration // Lifetime of an email verification token
+	MagicLinkTTL           time.Duration // Lifetime of a passwordless sign-in link
+	MagicLinkMaxRequests   int           // Sign-in links one address can request per window
+	MagicLinkWindow        time.Duration // Window MagicLinkMaxRequests applies to
+	RequireVerifiedLogin   bool          // Reject logins from users who haven't verified their email
+	RequireVerifiedSharing bool          // Reject adding users who haven't verified their email to ledgers
+	MFAIssuer              string        // Account issuer shown in authenticator apps
+	Throttle               ThrottleConfig
+	Password               PasswordConfig
+}
+
+// PasswordConfig holds the password hashing and policy settings
+type PasswordConfig struct {
+	Algorithm          string // "argon2id" or "bcrypt"; used for new hashes
+	Argon2Memory       int    // KiB
+	Argon2Iterations   int
+	Argon2Parallelism  int
+	BcryptCost         int
+	MinLength          int
+	MaxLength          int    // No limit if 0
+	BlocklistFile      string // File or directory of common and breached passwords, none if empty
+	RejectPersonalInfo bool   // Reject passwords containing the user's email or name
+}
+
+// ThrottleConfig holds the login brute-force protection settings
+type ThrottleConfig struct {
+	MaxAccountFailures int           // Failed logins for one account before it is locked
+	MaxIPFailures      int           // Failed logins from one IP address before it is locked
+	FailureWindow      time.Duration // Failures older than this are forgotten
+	LockoutBase        time.Duration // First lockout; doubles with every further failure
+	LockoutMax         time.Duration // Upper bound for a single lockout
+}
+
+// OIDCConfig holds the OpenID Connect social login configuration
+type OIDCConfig struct {
+	StateTTL  time.Duration                 // Time allowed to finish a login at the provider
+	Providers map[string]OIDCProviderConfig // Keyed by the provider name used in URLs
+}
+
+// WebAuthnConfig holds the passkey settings
+type WebAuthnConfig struct {
+	RPID         string        // Domain passkeys are bound to, e.g. "billapp.example"
+	RPName       string        // Shown by the authenticator when a passkey is created
+	Origins      []string      // Origins allowed to use the passkeys, including app origins such as "android:apk-key-hash:..."
+	ChallengeTTL time.Duration // Time allowed to finish a registration or login
+}
+
+// LedgerConfig holds the ledger lifecycle settings
+type LedgerConfig struct {
+	TrashRetention time.Duration // Time a deleted ledger can be restored before it is purged
+	PurgeInterval  time.Duration // How often expired ledgers are purged from the trash, never if 0
+	TransferTTL    time.Duration // Time the new owner has to accept an ownership transfer
+}
+
+// OIDCProviderConfig holds the settings for one identity provider
+type OIDCProviderConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // Where the provider sends the user back, usually an app deep link
+	Scopes       []string // Defaults to openid, email and profile
+}
+
+// MailConfig holds the outgoing mail configuration
+type MailConfig struct {
+	Driver       string // "smtp" or "log"
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	LogFile      string // File the log driver appends messages to, stdout if empty
 }
 
 // GetDSN returns the database connection string
@@ -46,7 +131,9 @@ func (c *DatabaseConfig) GetDSN() string {
 func LoadConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnvAsInt("SERVER_PORT", 8080),
+			Port:           getEnvAsInt("SERVER_PORT", 8080),
+			PublicURL:      getEnv("PUBLIC_URL", "http://localhost:8080"),
+			TrustedProxies: getEnvAsList("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:       getEnv("DB_HOST", "localhost"),
@@ -58,11 +145,86 @@ func LoadConfig() *Config {
 			TestDBName: getEnv("TEST_DB_NAME", "billapp_test"),
 		},
 		Auth: AuthConfig{
-			JWTSecret: getEnv("JWT_SECRET", "your-secret-key-here"),
+			JWTSecret:              getEnv("JWT_SECRET", "your-secret-key-here"),
+			JWTKeysDir:             getEnv("JWT_KEYS_DIR", ""),
+			JWTSigningKeyID:        getEnv("JWT_SIGNING_KEY_ID", ""),
+			AccessTokenTTL:         getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL:        getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			PasswordResetTTL:       getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+			EmailVerificationTTL:   getEnvAsDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			MagicLinkTTL:           getEnvAsDuration("MAGIC_LINK_TTL", 15*time.Minute),
+			MagicLinkMaxRequests:   getEnvAsInt("MAGIC_LINK_MAX_REQUESTS", 3),
+			MagicLinkWindow:        getEnvAsDuration("MAGIC_LINK_WINDOW", 15*time.Minute),
+			RequireVerifiedLogin:   getEnvAsBool("REQUIRE_VERIFIED_EMAIL_LOGIN", false),
+			RequireVerifiedSharing: getEnvAsBool("REQUIRE_VERIFIED_EMAIL_SHARING", false),
+			MFAIssuer:              getEnv("MFA_ISSUER", "Bill App"),
+			Throttle: ThrottleConfig{
+				MaxAccountFailures: getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+				MaxIPFailures:      getEnvAsInt("LOGIN_MAX_IP_FAILURES", 20),
+				FailureWindow:      getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+				LockoutBase:        getEnvAsDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+				LockoutMax:         getEnvAsDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+			},
+			Password: PasswordConfig{
+				Algorithm:          getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+				Argon2Memory:       getEnvAsInt("PASSWORD_ARGON2_MEMORY_KIB", 64*1024),
+				Argon2Iterations:   getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3),
+				Argon2Parallelism:  getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 2),
+				BcryptCost:         getEnvAsInt("PASSWORD_BCRYPT_COST", 10),
+				MinLength:          getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+				MaxLength:          getEnvAsInt("PASSWORD_MAX_LENGTH", 128),
+				BlocklistFile:      getEnv("PASSWORD_BLOCKLIST_FILE", ""),
+				RejectPersonalInfo: getEnvAsBool("PASSWORD_REJECT_PERSONAL_INFO", true),
+			},
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "no-reply@billapp.local"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			LogFile:      getEnv("MAIL_LOG_FILE", ""),
+		},
+		OIDC: OIDCConfig{
+			StateTTL:  getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute),
+			Providers: loadOIDCProviders(),
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:         getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPName:       getEnv("WEBAUTHN_RP_NAME", "Bill App"),
+			Origins:      strings.Split(getEnv("WEBAUTHN_ORIGINS", getEnv("PUBLIC_URL", "http://localhost:8080")), ","),
+			ChallengeTTL: getEnvAsDuration("WEBAUTHN_CHALLENGE_TTL", 5*time.Minute),
+		},
+		Ledger: LedgerConfig{
+			TrashRetention: getEnvAsDuration("LEDGER_TRASH_RETENTION", 30*24*time.Hour),
+			PurgeInterval:  getEnvAsDuration("LEDGER_PURGE_INTERVAL", time.Hour),
+			TransferTTL:    getEnvAsDuration("LEDGER_TRANSFER_TTL", 7*24*time.Hour),
 		},
 	}
 }
 
+// loadOIDCProviders reads OIDC_<NAME>_* variables for every name listed in OIDC_PROVIDERS
+func loadOIDCProviders() map[string]OIDCProviderConfig {
+	providers := make(map[string]OIDCProviderConfig)
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers[name] = OIDCProviderConfig{
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "")),
+		}
+	}
+	return providers
+}
+
 // Helper functions to read environment variables
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -78,3 +240,30 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsList splits a comma-separated variable, returning nil if it is unset or empty
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -41,6 +41,8 @@ func createTables(db *sqlx.DB) error {
 			email VARCHAR(255) UNIQUE NOT NULL,
 			name VARCHAR(255) NOT NULL,
 			password VARCHAR(255) NOT NULL,
+			token_version INTEGER NOT NULL DEFAULT 0,
+			email_verified_at TIMESTAMP,
 			created_at TIMESTAMP NOT NULL,
 			updated_at TIMESTAMP NOT NULL
 		)
@@ -58,7 +60,9 @@ func createTables(db *sqlx.DB) error {
 			currency VARCHAR(3) NOT NULL,
 			created_by VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 			created_at TIMESTAMP NOT NULL,
-			updated_at TIMESTAMP NOT NULL
+			updated_at TIMESTAMP NOT NULL,
+			deleted_at TIMESTAMP, -- Set while the ledger is in the trash
+			archived_at TIMESTAMP -- Set while the ledger is archived and read-only
 		)
 	`)
 	if err != nil {
@@ -84,7 +88,7 @@ func createTables(db *sqlx.DB) error {
 		CREATE TABLE IF NOT EXISTS ledger_changes (
 			id VARCHAR(36) PRIMARY KEY,
 			ledger_id VARCHAR(36) NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
-			user_id VARCHAR(36) NOT NULL REFERENCES users(id),
+			user_id VARCHAR(36) REFERENCES users(id) ON DELETE SET NULL, -- NULL once the author deleted their account
 			sequence_number BIGINT NOT NULL,
 			sql_statement TEXT NOT NULL,
 			timestamp TIMESTAMP NOT NULL,
@@ -96,10 +100,300 @@ func createTables(db *sqlx.DB) error {
 		return err
 	}
 
+	// Create refresh_tokens table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id VARCHAR(36) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create revoked_tokens table (access tokens revoked before they expire)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+			jti VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create auth_tokens table (single-use tokens sent by email)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS auth_tokens (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			purpose VARCHAR(32) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			payload TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_mfa table (TOTP enrolment, confirmed once the user proves a code)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_mfa (
+			user_id VARCHAR(36) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			totp_secret VARCHAR(64) NOT NULL,
+			confirmed_at TIMESTAMP,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create mfa_recovery_codes table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create login_throttles table (failed login counters per account and per IP address)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS login_throttles (
+			throttle_key VARCHAR(320) PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failure_at TIMESTAMP NOT NULL,
+			locked_until TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create oidc_states table (pending social logins; consumed by the callback)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS oidc_states (
+			state_hash VARCHAR(64) PRIMARY KEY,
+			provider VARCHAR(64) NOT NULL,
+			nonce VARCHAR(64) NOT NULL,
+			code_verifier VARCHAR(128) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_identities table (external identity provider accounts linked to users)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			provider VARCHAR(64) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			email VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (provider, subject)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create personal_access_tokens table (API tokens for integrations, limited to the ledgers listed in personal_access_token_ledgers)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS personal_access_tokens (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			permission VARCHAR(10) NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create personal_access_token_ledgers table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS personal_access_token_ledgers (
+			token_id VARCHAR(36) NOT NULL REFERENCES personal_access_tokens(id) ON DELETE CASCADE,
+			ledger_id VARCHAR(36) NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+			PRIMARY KEY (token_id, ledger_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create sessions table (one row per login, keyed by the refresh token family ID)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			device_name VARCHAR(255) NOT NULL DEFAULT '',
+			platform VARCHAR(50) NOT NULL DEFAULT '',
+			app_version VARCHAR(50) NOT NULL DEFAULT '',
+			ip_address VARCHAR(45) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create rate_limits table (requests per key in the current window, e.g. sign-in links per email address)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			limit_key VARCHAR(320) PRIMARY KEY,
+			hits INTEGER NOT NULL DEFAULT 0,
+			window_start TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create webauthn_credentials table (passkeys registered by users, with their COSE public keys)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			credential_id VARCHAR(1400) UNIQUE NOT NULL,
+			public_key BYTEA NOT NULL,
+			sign_count BIGINT NOT NULL DEFAULT 0,
+			name VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create webauthn_challenges table (pending passkey registrations and logins; consumed when they finish)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webauthn_challenges (
+			challenge_hash VARCHAR(64) PRIMARY KEY,
+			ceremony VARCHAR(20) NOT NULL,
+			user_id VARCHAR(36) REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create ledger_events table (metadata changes and other events on the ledger itself)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS ledger_events (
+			id VARCHAR(36) PRIMARY KEY,
+			ledger_id VARCHAR(36) NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+			user_id VARCHAR(36) REFERENCES users(id) ON DELETE SET NULL, -- NULL once the user deleted their account
+			type VARCHAR(50) NOT NULL,
+			details JSONB NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create ledger_transfers table (ownership transfers proposed by the owner and awaiting the new owner)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS ledger_transfers (
+			ledger_id VARCHAR(36) PRIMARY KEY REFERENCES ledgers(id) ON DELETE CASCADE,
+			from_user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			to_user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create ledger_templates table (ledger templates saved by users; built-in templates are defined by the server)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS ledger_templates (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			currency VARCHAR(3) NOT NULL DEFAULT '',
+			statements TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Add columns introduced after the initial schema to existing databases
+	migrations := []string{
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP",
+		"ALTER TABLE ledger_changes ALTER COLUMN user_id DROP NOT NULL",
+		"ALTER TABLE ledger_changes DROP CONSTRAINT IF EXISTS ledger_changes_user_id_fkey",
+		"ALTER TABLE ledger_changes ADD CONSTRAINT ledger_changes_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL",
+		"ALTER TABLE ledgers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP",
+		"ALTER TABLE ledgers ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP",
+		"UPDATE ledgers SET currency = UPPER(currency) WHERE currency <> UPPER(currency)",
+	}
+
+	for _, migration := range migrations {
+		_, err = db.Exec(migration)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create indexes for better performance
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_ledger_changes_ledger_id ON ledger_changes(ledger_id)",
 		"CREATE INDEX IF NOT EXISTS idx_ledger_changes_ledger_seq ON ledger_changes(ledger_id, sequence_number)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id)",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_purpose ON auth_tokens(user_id, purpose)",
+		"CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_oidc_states_expires_at ON oidc_states(expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_ledger_changes_user_id ON ledger_changes(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at)",
+		"CREATE INDEX IF NOT EXISTS idx_ledger_events_ledger_created ON ledger_events(ledger_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_ledgers_deleted_at ON ledgers(deleted_at) WHERE deleted_at IS NOT NULL",
+		"CREATE INDEX IF NOT EXISTS idx_ledger_transfers_to_user_id ON ledger_transfers(to_user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_ledger_templates_user_id ON ledger_templates(user_id)",
 	}
 
 	for _, idx := range indexes {
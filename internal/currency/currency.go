@@ -0,0 +1,189 @@
+// Package currency is a registry of the ISO 4217 currencies ledgers can be kept in
+package currency
+
+import (
+	"strings"
+
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// currencies lists the active ISO 4217 currencies in code order. Fund codes, precious metals
+// and the testing codes are left out, as no ledger is kept in them.
+var currencies = []models.Currency{
+	{Code: "AED", Name: "UAE Dirham", MinorUnits: 2, Symbol: "د.إ"},
+	{Code: "AFN", Name: "Afghani", MinorUnits: 2, Symbol: "؋"},
+	{Code: "ALL", Name: "Lek", MinorUnits: 2, Symbol: "L"},
+	{Code: "AMD", Name: "Armenian Dram", MinorUnits: 2, Symbol: "֏"},
+	{Code: "AOA", Name: "Kwanza", MinorUnits: 2, Symbol: "Kz"},
+	{Code: "ARS", Name: "Argentine Peso", MinorUnits: 2, Symbol: "$"},
+	{Code: "AUD", Name: "Australian Dollar", MinorUnits: 2, Symbol: "A$"},
+	{Code: "AWG", Name: "Aruban Florin", MinorUnits: 2, Symbol: "ƒ"},
+	{Code: "AZN", Name: "Azerbaijan Manat", MinorUnits: 2, Symbol: "₼"},
+	{Code: "BAM", Name: "Convertible Mark", MinorUnits: 2, Symbol: "KM"},
+	{Code: "BBD", Name: "Barbados Dollar", MinorUnits: 2, Symbol: "Bds$"},
+	{Code: "BDT", Name: "Taka", MinorUnits: 2, Symbol: "৳"},
+	{Code: "BHD", Name: "Bahraini Dinar", MinorUnits: 3, Symbol: "BD"},
+	{Code: "BIF", Name: "Burundi Franc", MinorUnits: 0, Symbol: "FBu"},
+	{Code: "BMD", Name: "Bermudian Dollar", MinorUnits: 2, Symbol: "$"},
+	{Code: "BND", Name: "Brunei Dollar", MinorUnits: 2, Symbol: "B$"},
+	{Code: "BOB", Name: "Boliviano", MinorUnits: 2, Symbol: "Bs."},
+	{Code: "BRL", Name: "Brazilian Real", MinorUnits: 2, Symbol: "R$"},
+	{Code: "BSD", Name: "Bahamian Dollar", MinorUnits: 2, Symbol: "B$"},
+	{Code: "BTN", Name: "Ngultrum", MinorUnits: 2, Symbol: "Nu."},
+	{Code: "BWP", Name: "Pula", MinorUnits: 2, Symbol: "P"},
+	{Code: "BYN", Name: "Belarusian Ruble", MinorUnits: 2, Symbol: "Br"},
+	{Code: "BZD", Name: "Belize Dollar", MinorUnits: 2, Symbol: "BZ$"},
+	{Code: "CAD", Name: "Canadian Dollar", MinorUnits: 2, Symbol: "C$"},
+	{Code: "CDF", Name: "Congolese Franc", MinorUnits: 2, Symbol: "FC"},
+	{Code: "CHF", Name: "Swiss Franc", MinorUnits: 2, Symbol: "CHF"},
+	{Code: "CLP", Name: "Chilean Peso", MinorUnits: 0, Symbol: "$"},
+	{Code: "CNY", Name: "Yuan Renminbi", MinorUnits: 2, Symbol: "¥"},
+	{Code: "COP", Name: "Colombian Peso", MinorUnits: 2, Symbol: "$"},
+	{Code: "CRC", Name: "Costa Rican Colon", MinorUnits: 2, Symbol: "₡"},
+	{Code: "CUP", Name: "Cuban Peso", MinorUnits: 2, Symbol: "$"},
+	{Code: "CVE", Name: "Cabo Verde Escudo", MinorUnits: 2, Symbol: "Esc"},
+	{Code: "CZK", Name: "Czech Koruna", MinorUnits: 2, Symbol: "Kč"},
+	{Code: "DJF", Name: "Djibouti Franc", MinorUnits: 0, Symbol: "Fdj"},
+	{Code: "DKK", Name: "Danish Krone", MinorUnits: 2, Symbol: "kr"},
+	{Code: "DOP", Name: "Dominican Peso", MinorUnits: 2, Symbol: "RD$"},
+	{Code: "DZD", Name: "Algerian Dinar", MinorUnits: 2, Symbol: "DA"},
+	{Code: "EGP", Name: "Egyptian Pound", MinorUnits: 2, Symbol: "E£"},
+	{Code: "ERN", Name: "Nakfa", MinorUnits: 2, Symbol: "Nfk"},
+	{Code: "ETB", Name: "Ethiopian Birr", MinorUnits: 2, Symbol: "Br"},
+	{Code: "EUR", Name: "Euro", MinorUnits: 2, Symbol: "€"},
+	{Code: "FJD", Name: "Fiji Dollar", MinorUnits: 2, Symbol: "FJ$"},
+	{Code: "FKP", Name: "Falkland Islands Pound", MinorUnits: 2, Symbol: "£"},
+	{Code: "GBP", Name: "Pound Sterling", MinorUnits: 2, Symbol: "£"},
+	{Code: "GEL", Name: "Lari", MinorUnits: 2, Symbol: "₾"},
+	{Code: "GHS", Name: "Ghana Cedi", MinorUnits: 2, Symbol: "GH₵"},
+	{Code: "GIP", Name: "Gibraltar Pound", MinorUnits: 2, Symbol: "£"},
+	{Code: "GMD", Name: "Dalasi", MinorUnits: 2, Symbol: "D"},
+	{Code: "GNF", Name: "Guinean Franc", MinorUnits: 0, Symbol: "FG"},
+	{Code: "GTQ", Name: "Quetzal", MinorUnits: 2, Symbol: "Q"},
+	{Code: "GYD", Name: "Guyana Dollar", MinorUnits: 2, Symbol: "G$"},
+	{Code: "HKD", Name: "Hong Kong Dollar", MinorUnits: 2, Symbol: "HK$"},
+	{Code: "HNL", Name: "Lempira", MinorUnits: 2, Symbol: "L"},
+	{Code: "HTG", Name: "Gourde", MinorUnits: 2, Symbol: "G"},
+	{Code: "HUF", Name: "Forint", MinorUnits: 2, Symbol: "Ft"},
+	{Code: "IDR", Name: "Rupiah", MinorUnits: 2, Symbol: "Rp"},
+	{Code: "ILS", Name: "New Israeli Sheqel", MinorUnits: 2, Symbol: "₪"},
+	{Code: "INR", Name: "Indian Rupee", MinorUnits: 2, Symbol: "₹"},
+	{Code: "IQD", Name: "Iraqi Dinar", MinorUnits: 3, Symbol: "ID"},
+	{Code: "IRR", Name: "Iranian Rial", MinorUnits: 2, Symbol: "﷼"},
+	{Code: "ISK", Name: "Iceland Krona", MinorUnits: 0, Symbol: "kr"},
+	{Code: "JMD", Name: "Jamaican Dollar", MinorUnits: 2, Symbol: "J$"},
+	{Code: "JOD", Name: "Jordanian Dinar", MinorUnits: 3, Symbol: "JD"},
+	{Code: "JPY", Name: "Yen", MinorUnits: 0, Symbol: "¥"},
+	{Code: "KES", Name: "Kenyan Shilling", MinorUnits: 2, Symbol: "KSh"},
+	{Code: "KGS", Name: "Som", MinorUnits: 2, Symbol: "сом"},
+	{Code: "KHR", Name: "Riel", MinorUnits: 2, Symbol: "៛"},
+	{Code: "KMF", Name: "Comorian Franc", MinorUnits: 0, Symbol: "CF"},
+	{Code: "KPW", Name: "North Korean Won", MinorUnits: 2, Symbol: "₩"},
+	{Code: "KRW", Name: "Won", MinorUnits: 0, Symbol: "₩"},
+	{Code: "KWD", Name: "Kuwaiti Dinar", MinorUnits: 3, Symbol: "KD"},
+	{Code: "KYD", Name: "Cayman Islands Dollar", MinorUnits: 2, Symbol: "CI$"},
+	{Code: "KZT", Name: "Tenge", MinorUnits: 2, Symbol: "₸"},
+	{Code: "LAK", Name: "Lao Kip", MinorUnits: 2, Symbol: "₭"},
+	{Code: "LBP", Name: "Lebanese Pound", MinorUnits: 2, Symbol: "L£"},
+	{Code: "LKR", Name: "Sri Lanka Rupee", MinorUnits: 2, Symbol: "Rs"},
+	{Code: "LRD", Name: "Liberian Dollar", MinorUnits: 2, Symbol: "L$"},
+	{Code: "LSL", Name: "Loti", MinorUnits: 2, Symbol: "L"},
+	{Code: "LYD", Name: "Libyan Dinar", MinorUnits: 3, Symbol: "LD"},
+	{Code: "MAD", Name: "Moroccan Dirham", MinorUnits: 2, Symbol: "DH"},
+	{Code: "MDL", Name: "Moldovan Leu", MinorUnits: 2, Symbol: "L"},
+	{Code: "MGA", Name: "Malagasy Ariary", MinorUnits: 2, Symbol: "Ar"},
+	{Code: "MKD", Name: "Denar", MinorUnits: 2, Symbol: "ден"},
+	{Code: "MMK", Name: "Kyat", MinorUnits: 2, Symbol: "K"},
+	{Code: "MNT", Name: "Tugrik", MinorUnits: 2, Symbol: "₮"},
+	{Code: "MOP", Name: "Pataca", MinorUnits: 2, Symbol: "MOP$"},
+	{Code: "MRU", Name: "Ouguiya", MinorUnits: 2, Symbol: "UM"},
+	{Code: "MUR", Name: "Mauritius Rupee", MinorUnits: 2, Symbol: "Rs"},
+	{Code: "MVR", Name: "Rufiyaa", MinorUnits: 2, Symbol: "Rf"},
+	{Code: "MWK", Name: "Malawi Kwacha", MinorUnits: 2, Symbol: "MK"},
+	{Code: "MXN", Name: "Mexican Peso", MinorUnits: 2, Symbol: "$"},
+	{Code: "MYR", Name: "Malaysian Ringgit", MinorUnits: 2, Symbol: "RM"},
+	{Code: "MZN", Name: "Mozambique Metical", MinorUnits: 2, Symbol: "MT"},
+	{Code: "NAD", Name: "Namibia Dollar", MinorUnits: 2, Symbol: "N$"},
+	{Code: "NGN", Name: "Naira", MinorUnits: 2, Symbol: "₦"},
+	{Code: "NIO", Name: "Cordoba Oro", MinorUnits: 2, Symbol: "C$"},
+	{Code: "NOK", Name: "Norwegian Krone", MinorUnits: 2, Symbol: "kr"},
+	{Code: "NPR", Name: "Nepalese Rupee", MinorUnits: 2, Symbol: "Rs"},
+	{Code: "NZD", Name: "New Zealand Dollar", MinorUnits: 2, Symbol: "NZ$"},
+	{Code: "OMR", Name: "Rial Omani", MinorUnits: 3, Symbol: "RO"},
+	{Code: "PAB", Name: "Balboa", MinorUnits: 2, Symbol: "B/."},
+	{Code: "PEN", Name: "Sol", MinorUnits: 2, Symbol: "S/"},
+	{Code: "PGK", Name: "Kina", MinorUnits: 2, Symbol: "K"},
+	{Code: "PHP", Name: "Philippine Peso", MinorUnits: 2, Symbol: "₱"},
+	{Code: "PKR", Name: "Pakistan Rupee", MinorUnits: 2, Symbol: "Rs"},
+	{Code: "PLN", Name: "Zloty", MinorUnits: 2, Symbol: "zł"},
+	{Code: "PYG", Name: "Guarani", MinorUnits: 0, Symbol: "₲"},
+	{Code: "QAR", Name: "Qatari Rial", MinorUnits: 2, Symbol: "QR"},
+	{Code: "RON", Name: "Romanian Leu", MinorUnits: 2, Symbol: "lei"},
+	{Code: "RSD", Name: "Serbian Dinar", MinorUnits: 2, Symbol: "дин."},
+	{Code: "RUB", Name: "Russian Ruble", MinorUnits: 2, Symbol: "₽"},
+	{Code: "RWF", Name: "Rwanda Franc", MinorUnits: 0, Symbol: "FRw"},
+	{Code: "SAR", Name: "Saudi Riyal", MinorUnits: 2, Symbol: "SR"},
+	{Code: "SBD", Name: "Solomon Islands Dollar", MinorUnits: 2, Symbol: "SI$"},
+	{Code: "SCR", Name: "Seychelles Rupee", MinorUnits: 2, Symbol: "SR"},
+	{Code: "SDG", Name: "Sudanese Pound", MinorUnits: 2, Symbol: "£SD"},
+	{Code: "SEK", Name: "Swedish Krona", MinorUnits: 2, Symbol: "kr"},
+	{Code: "SGD", Name: "Singapore Dollar", MinorUnits: 2, Symbol: "S$"},
+	{Code: "SHP", Name: "Saint Helena Pound", MinorUnits: 2, Symbol: "£"},
+	{Code: "SLE", Name: "Leone", MinorUnits: 2, Symbol: "Le"},
+	{Code: "SOS", Name: "Somali Shilling", MinorUnits: 2, Symbol: "Sh"},
+	{Code: "SRD", Name: "Surinam Dollar", MinorUnits: 2, Symbol: "$"},
+	{Code: "SSP", Name: "South Sudanese Pound", MinorUnits: 2, Symbol: "£"},
+	{Code: "STN", Name: "Dobra", MinorUnits: 2, Symbol: "Db"},
+	{Code: "SVC", Name: "El Salvador Colon", MinorUnits: 2, Symbol: "₡"},
+	{Code: "SYP", Name: "Syrian Pound", MinorUnits: 2, Symbol: "£S"},
+	{Code: "SZL", Name: "Lilangeni", MinorUnits: 2, Symbol: "E"},
+	{Code: "THB", Name: "Baht", MinorUnits: 2, Symbol: "฿"},
+	{Code: "TJS", Name: "Somoni", MinorUnits: 2, Symbol: "SM"},
+	{Code: "TMT", Name: "Turkmenistan New Manat", MinorUnits: 2, Symbol: "m"},
+	{Code: "TND", Name: "Tunisian Dinar", MinorUnits: 3, Symbol: "DT"},
+	{Code: "TOP", Name: "Pa'anga", MinorUnits: 2, Symbol: "T$"},
+	{Code: "TRY", Name: "Turkish Lira", MinorUnits: 2, Symbol: "₺"},
+	{Code: "TTD", Name: "Trinidad and Tobago Dollar", MinorUnits: 2, Symbol: "TT$"},
+	{Code: "TWD", Name: "New Taiwan Dollar", MinorUnits: 2, Symbol: "NT$"},
+	{Code: "TZS", Name: "Tanzanian Shilling", MinorUnits: 2, Symbol: "TSh"},
+	{Code: "UAH", Name: "Hryvnia", MinorUnits: 2, Symbol: "₴"},
+	{Code: "UGX", Name: "Uganda Shilling", MinorUnits: 0, Symbol: "USh"},
+	{Code: "USD", Name: "US Dollar", MinorUnits: 2, Symbol: "$"},
+	{Code: "UYU", Name: "Peso Uruguayo", MinorUnits: 2, Symbol: "$U"},
+	{Code: "UZS", Name: "Uzbekistan Sum", MinorUnits: 2, Symbol: "soʻm"},
+	{Code: "VED", Name: "Bolívar Soberano", MinorUnits: 2, Symbol: "Bs.D"},
+	{Code: "VES", Name: "Bolívar Soberano", MinorUnits: 2, Symbol: "Bs.S"},
+	{Code: "VND", Name: "Dong", MinorUnits: 0, Symbol: "₫"},
+	{Code: "VUV", Name: "Vatu", MinorUnits: 0, Symbol: "VT"},
+	{Code: "WST", Name: "Tala", MinorUnits: 2, Symbol: "WS$"},
+	{Code: "XAF", Name: "CFA Franc BEAC", MinorUnits: 0, Symbol: "FCFA"},
+	{Code: "XCD", Name: "East Caribbean Dollar", MinorUnits: 2, Symbol: "EC$"},
+	{Code: "XCG", Name: "Caribbean Guilder", MinorUnits: 2, Symbol: "Cg"},
+	{Code: "XOF", Name: "CFA Franc BCEAO", MinorUnits: 0, Symbol: "CFA"},
+	{Code: "XPF", Name: "CFP Franc", MinorUnits: 0, Symbol: "₣"},
+	{Code: "YER", Name: "Yemeni Rial", MinorUnits: 2, Symbol: "﷼"},
+	{Code: "ZAR", Name: "Rand", MinorUnits: 2, Symbol: "R"},
+	{Code: "ZMW", Name: "Zambian Kwacha", MinorUnits: 2, Symbol: "ZK"},
+	{Code: "ZWG", Name: "Zimbabwe Gold", MinorUnits: 2, Symbol: "ZiG"},
+}
+
+// byCode indexes currencies by their code
+var byCode = func() map[string]models.Currency {
+	m := make(map[string]models.Currency, len(currencies))
+	for _, c := range currencies {
+		m[c.Code] = c
+	}
+	return m
+}()
+
+// Lookup returns the currency with the code. Codes are matched in any case and with
+// surrounding spaces, so "usd " finds the US dollar.
+func Lookup(code string) (models.Currency, bool) {
+	c, ok := byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return c, ok
+}
+
+// All returns every currency in code order
+func All() []models.Currency {
+	return append([]models.Currency{}, currencies...)
+}
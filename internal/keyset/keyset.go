@@ -0,0 +1,191 @@
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rongwang/COMP90018-server/internal/config"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// Key is a single JWT signing or verification key
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{} // nil for keys that are only kept to verify older tokens
+	verifyKey interface{}
+}
+
+// KeySet signs tokens with its current key and verifies tokens signed by any key it holds
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// New creates the KeySet selected by the configuration. Without a key directory tokens
+// are signed with the shared HMAC secret.
+func New(cfg config.AuthConfig) (*KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return NewHMAC([]byte(cfg.JWTSecret)), nil
+	}
+	return Load(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+}
+
+// NewHMAC creates a KeySet holding a single HS256 secret. Its tokens carry no kid.
+func NewHMAC(secret []byte) *KeySet {
+	key := &Key{Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+	return &KeySet{signing: key, keys: map[string]*Key{"": key}}
+}
+
+// Load reads every *.pem file in dir. The file name without its extension is the key ID.
+// Private keys can sign; public keys only verify tokens signed before a rotation.
+// Without a signingKeyID the private key with the last ID in sort order signs.
+func Load(dir, signingKeyID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]*Key)}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+		}
+
+		ks.keys[id] = key
+		if key.signKey != nil && (signingKeyID == "" || id == signingKeyID) {
+			ks.signing = key
+		}
+	}
+
+	if ks.signing == nil {
+		if signingKeyID != "" {
+			return nil, fmt.Errorf("signing key %q not found in %s", signingKeyID, dir)
+		}
+		return nil, fmt.Errorf("no private key found in %s", dir)
+	}
+
+	return ks, nil
+}
+
+// ParsePEM parses an RSA or Ed25519 key. Private keys may be PKCS#8 or PKCS#1,
+// public keys must be PKIX.
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// Sign signs the claims with the current signing key
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies the token signature and expiry and returns its claims
+func (ks *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+
+		// The algorithm is fixed by the key, never by the token header
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys in JSON Web Key Set format. HMAC secrets are never published.
+func (ks *KeySet) JWKS() models.JWKSResponse {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	res := models.JWKSResponse{Keys: []models.JWK{}}
+	for _, id := range ids {
+		key := ks.keys[id]
+
+		jwk := models.JWK{KeyID: id, Use: "sig", Algorithm: key.Method.Alg()}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		res.Keys = append(res.Keys, jwk)
+	}
+
+	return res
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// LogMailer writes messages to a writer instead of sending them.
+// It is meant for development, where the log is read by hand.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewLogMailer creates a new LogMailer
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{
+		w:    w,
+		from: from,
+	}
+}
+
+// Send writes the message followed by a separator line
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.w.Write(formatMessage(m.from, msg)); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(m.w, "\r\n----\r\n")
+	return err
+}
@@ -1,45 +1,327 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        string    `db:"id" json:"id"`
-	Email     string    `db:"email" json:"email"`
-	Name      string    `db:"name" json:"name"`
-	Password  string    `db:"password" json:"-"` // Password hash, not returned in JSON
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	ID              string     `db:"id" json:"id"`
+	Email           string     `db:"email" json:"email"`
+	Name            string     `db:"name" json:"name"`
+	Password        string     `db:"password" json:"-"`      // Password hash, not returned in JSON
+	TokenVersion    int        `db:"token_version" json:"-"` // Bumped to invalidate every token issued before
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"emailVerifiedAt,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updatedAt"`
 }
 
 // Ledger represents a ledger owned by users
 type Ledger struct {
-	ID          string    `db:"id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Description string    `db:"description" json:"description"`
-	Currency    string    `db:"currency" json:"currency"`
-	CreatedBy   string    `db:"created_by" json:"createdBy"`
-	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt   time.Time `db:"updated_at" json:"updatedAt"`
+	ID          string     `db:"id" json:"id"`
+	Name        string     `db:"name" json:"name"`
+	Description string     `db:"description" json:"description"`
+	Currency    string     `db:"currency" json:"currency"`
+	CreatedBy   string     `db:"created_by" json:"createdBy"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updatedAt"`
+	DeletedAt   *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`   // Set while the ledger is in the trash
+	ArchivedAt  *time.Time `db:"archived_at" json:"archivedAt,omitempty"` // Set while the ledger is archived and read-only
+}
+
+// ETag identifies the version of the ledger's metadata, for optimistic concurrency on updates
+func (l Ledger) ETag() string {
+	return `"` + l.UpdatedAt.UTC().Format(time.RFC3339Nano) + `"`
 }
 
 // LedgerUser represents the relationship between users and ledgers (for sharing)
 type LedgerUser struct {
 	LedgerID    string    `db:"ledger_id" json:"ledgerId"`
 	UserID      string    `db:"user_id" json:"userId"`
-	Permissions string    `db:"permissions" json:"permissions"` // "read" or "write"
+	Permissions string    `db:"permissions" json:"permissions"` // "read", "write" or "admin"
 	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
 }
 
+// LedgerTransfer is a change of owner proposed by the ledger's owner. Ownership only moves
+// once the new owner accepts it.
+type LedgerTransfer struct {
+	LedgerID   string    `db:"ledger_id" json:"ledgerId"`
+	FromUserID string    `db:"from_user_id" json:"fromUserId"`
+	ToUserID   string    `db:"to_user_id" json:"toUserId"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+}
+
+// LedgerTemplate is a starting point for new ledgers: default details, and the changes every
+// ledger made from it starts with. Built-in templates are defined by the server; the others
+// are saved by their user and only visible to them.
+type LedgerTemplate struct {
+	ID          string         `db:"id" json:"id"`
+	UserID      string         `db:"user_id" json:"-"` // Empty for built-in templates
+	Builtin     bool           `db:"-" json:"builtin"`
+	Name        string         `db:"name" json:"name"`
+	Description string         `db:"description" json:"description"`        // Default description of new ledgers
+	Currency    string         `db:"currency" json:"currency,omitempty"`    // Default currency of new ledgers, none if empty
+	Statements  pq.StringArray `db:"statements" json:"statements"`          // Seed changes, in order
+	CreatedAt   *time.Time     `db:"created_at" json:"createdAt,omitempty"` // nil for built-in templates
+}
+
 // LedgerChange represents a change made to a ledger
 type LedgerChange struct {
 	ID              string    `db:"id" json:"id"`
 	LedgerID        string    `db:"ledger_id" json:"ledgerId"`
-	UserID          string    `db:"user_id" json:"userId"`
+	UserID          *string   `db:"user_id" json:"userId"` // nil if the author deleted their account
 	SequenceNumber  int64     `db:"sequence_number" json:"sequenceNumber"`
 	SQLStatement    string    `db:"sql_statement" json:"sqlStatement"`
 	Timestamp       time.Time `db:"timestamp" json:"timestamp"`
 	BaseSequenceNum int64     `db:"base_sequence_number" json:"baseSequenceNumber"`
 }
+
+// RefreshToken represents a single-use refresh token. Tokens issued from the same
+// login share a FamilyID so that the whole chain can be revoked on reuse.
+type RefreshToken struct {
+	ID        string     `db:"id" json:"id"`
+	UserID    string     `db:"user_id" json:"userId"`
+	FamilyID  string     `db:"family_id" json:"familyId"`
+	TokenHash string     `db:"token_hash" json:"-"` // SHA-256 of the token, the token itself is never stored
+	ExpiresAt time.Time  `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt,omitempty"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// Purposes of single-use tokens sent to users by email
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification" // Payload is the address being verified
+	TokenPurposeEmailChange       = "email_change"       // Payload is the new address
+	TokenPurposeMagicLink         = "magic_link"         // Payload is the address the link was sent to
+)
+
+// AuthToken represents a single-use token sent to a user, such as a password reset link
+type AuthToken struct {
+	ID        string     `db:"id" json:"id"`
+	UserID    string     `db:"user_id" json:"userId"`
+	Purpose   string     `db:"purpose" json:"purpose"`
+	TokenHash string     `db:"token_hash" json:"-"` // SHA-256 of the token, the token itself is never stored
+	Payload   string     `db:"payload" json:"-"`    // Purpose-specific data
+	ExpiresAt time.Time  `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// UserMFA holds a user's TOTP enrolment. Two-factor login is only enforced once ConfirmedAt is set.
+type UserMFA struct {
+	UserID       string     `db:"user_id" json:"userId"`
+	TOTPSecret   string     `db:"totp_secret" json:"-"`
+	ConfirmedAt  *time.Time `db:"confirmed_at" json:"confirmedAt,omitempty"`
+	LastUsedStep int64      `db:"last_used_step" json:"-"` // Last accepted TOTP time step, to prevent code replay
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// MFARecoveryCode represents a single-use code that replaces a TOTP code when the device is lost
+type MFARecoveryCode struct {
+	ID        string     `db:"id" json:"id"`
+	UserID    string     `db:"user_id" json:"userId"`
+	CodeHash  string     `db:"code_hash" json:"-"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// LoginThrottle counts recent failed logins for an account or an IP address
+type LoginThrottle struct {
+	Key           string     `db:"throttle_key" json:"key"`
+	Failures      int        `db:"failures" json:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at" json:"lastFailureAt"`
+	LockedUntil   *time.Time `db:"locked_until" json:"lockedUntil,omitempty"`
+}
+
+// RateLimit counts requests for a key within a fixed window
+type RateLimit struct {
+	Key         string    `db:"limit_key" json:"key"`
+	Hits        int       `db:"hits" json:"hits"`
+	WindowStart time.Time `db:"window_start" json:"windowStart"`
+}
+
+// OIDCState is a social login that was started but not yet completed
+type OIDCState struct {
+	StateHash    string    `db:"state_hash" json:"-"`
+	Provider     string    `db:"provider" json:"provider"`
+	Nonce        string    `db:"nonce" json:"-"`
+	CodeVerifier string    `db:"code_verifier" json:"-"`
+	ExpiresAt    time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+}
+
+// UserIdentity links an account at an external identity provider to a user
+type UserIdentity struct {
+	Provider  string    `db:"provider" json:"provider"`
+	Subject   string    `db:"subject" json:"subject"`
+	UserID    string    `db:"user_id" json:"userId"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// PersonalAccessToken lets an integration call the API as the user, limited to some ledgers
+type PersonalAccessToken struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     string     `db:"user_id" json:"userId"`
+	Name       string     `db:"name" json:"name"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	Permission string     `db:"permission" json:"permission"` // "read" or "write"
+	ExpiresAt  *time.Time `db:"expires_at" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"-"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	LedgerIDs  []string   `db:"-" json:"ledgerIds"`
+}
+
+// WebAuthnCredential is a passkey registered to a user
+type WebAuthnCredential struct {
+	ID           string     `db:"id" json:"id"`
+	UserID       string     `db:"user_id" json:"userId"`
+	CredentialID string     `db:"credential_id" json:"credentialId"` // base64url, as the browser reports it
+	PublicKey    []byte     `db:"public_key" json:"-"`               // COSE_Key
+	SignCount    int64      `db:"sign_count" json:"-"`
+	Name         string     `db:"name" json:"name"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	LastUsedAt   *time.Time `db:"last_used_at" json:"lastUsedAt,omitempty"`
+}
+
+// WebAuthn ceremonies a challenge can be used for
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnChallenge is a passkey registration or login that was started but not yet finished
+type WebAuthnChallenge struct {
+	ChallengeHash string    `db:"challenge_hash" json:"-"`
+	Ceremony      string    `db:"ceremony" json:"ceremony"`
+	UserID        *string   `db:"user_id" json:"userId,omitempty"` // Only set for registrations
+	ExpiresAt     time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt     time.Time `db:"created_at" json:"createdAt"`
+}
+
+// Session is a signed-in device. Its ID is the refresh token family ID, which access tokens carry as "sid".
+type Session struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     string     `db:"user_id" json:"-"`
+	DeviceName string     `db:"device_name" json:"deviceName"`
+	Platform   string     `db:"platform" json:"platform"`
+	AppVersion string     `db:"app_version" json:"appVersion"`
+	IPAddress  string     `db:"ip_address" json:"ipAddress"`
+	UserAgent  string     `db:"user_agent" json:"userAgent"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	LastSeenAt time.Time  `db:"last_seen_at" json:"lastSeenAt"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"-"`
+	Current    bool       `db:"-" json:"current"` // The session making the request
+}
+
+// LedgerMembership is a ledger the user belongs to, as listed in their data export
+type LedgerMembership struct {
+	LedgerID    string    `db:"ledger_id" json:"ledgerId"`
+	Name        string    `db:"name" json:"name"`
+	Currency    string    `db:"currency" json:"currency"`
+	Owner       bool      `db:"owner" json:"owner"`
+	Permissions string    `db:"permissions" json:"permissions"`
+	JoinedAt    time.Time `db:"joined_at" json:"joinedAt"`
+}
+
+// LedgerMember is a user a ledger is shared with, as shown to the other members
+type LedgerMember struct {
+	UserID      string    `db:"user_id" json:"userId"`
+	Name        string    `db:"name" json:"name"`
+	Email       string    `db:"email" json:"email"`
+	Permissions string    `db:"permissions" json:"permissions"`
+	Owner       bool      `db:"owner" json:"owner"`
+	JoinedAt    time.Time `db:"joined_at" json:"joinedAt"`
+}
+
+// LedgerSummary is a ledger as listed for one of its members
+type LedgerSummary struct {
+	Ledger
+	Permissions          string    `db:"permissions" json:"permissions"` // The caller's permission
+	Owner                bool      `db:"owner" json:"owner"`
+	MemberCount          int       `db:"member_count" json:"memberCount"`
+	LatestSequenceNumber int64     `db:"latest_sequence_number" json:"latestSequenceNumber"`
+	LastActivityAt       time.Time `db:"last_activity_at" json:"lastActivityAt"` // Latest change, or the ledger's last update if later
+}
+
+// LedgerListFilter selects, orders and pages the ledgers listed for a user
+type LedgerListFilter struct {
+	Ownership  string   // "owned", "shared" or empty for both
+	Currency   string   // Empty for every currency
+	Archived   string   // "exclude", "include" or "only"
+	LedgerIDs  []string // Only these ledgers if not nil
+	Sort       string   // "lastActivity", "name" or "createdAt"
+	Descending bool
+	AfterValue interface{} // Sort value of the last ledger on the previous page, nil for the first page
+	AfterID    string      // ID of the last ledger on the previous page, breaks ties in the sort value
+	Limit      int
+}
+
+// Types of ledger events
+const (
+	LedgerEventMetadataUpdated = "metadata_updated" // Details map each changed field to its "from" and "to" values
+	LedgerEventTrashed         = "trashed"
+	LedgerEventRestored        = "restored"
+	LedgerEventArchived        = "archived"
+	LedgerEventUnarchived      = "unarchived"
+	LedgerEventOwnerChanged    = "owner_changed" // Details hold the "from" and "to" user IDs
+	LedgerEventForked          = "forked"        // Details hold the "sourceLedgerId" and "atSequence" it was forked at
+)
+
+// LedgerEvent records a change to the ledger itself rather than to its entries, such as a
+// rename, so that the members' clients know to refresh it
+type LedgerEvent struct {
+	ID        string             `db:"id" json:"id"`
+	LedgerID  string             `db:"ledger_id" json:"ledgerId"`
+	UserID    *string            `db:"user_id" json:"userId"` // nil if the user deleted their account
+	Type      string             `db:"type" json:"type"`
+	Details   LedgerEventDetails `db:"details" json:"details"`
+	CreatedAt time.Time          `db:"created_at" json:"createdAt"`
+}
+
+// LedgerEventDetails holds the fields specific to an event type, stored as JSON
+type LedgerEventDetails map[string]interface{}
+
+// Value implements driver.Valuer
+func (d LedgerEventDetails) Value() (driver.Value, error) {
+	if d == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (d *LedgerEventDetails) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case nil:
+		*d = nil
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into LedgerEventDetails", src)
+}
+
+// Currency is an ISO 4217 currency a ledger can be kept in
+type Currency struct {
+	Code       string `json:"code"`       // Three-letter code, e.g. "USD"
+	Name       string `json:"name"`       // English name as given by ISO 4217
+	MinorUnits int    `json:"minorUnits"` // Digits after the decimal point, e.g. 2 for cents
+	Symbol     string `json:"symbol"`     // Local symbol, which several currencies may share
+}
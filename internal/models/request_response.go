@@ -1,21 +1,187 @@
 package models
 
+import (
+	"time"
+)
+
 // Request models
 type SignUpRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"` // Checked against the password policy
 	Name     string `json:"name" binding:"required"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	DeviceInfo
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfaToken" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" binding:"required_without=Code"`
+	DeviceInfo
+}
+
+// MagicLinkRequest asks for a passwordless sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConsumeMagicLinkRequest exchanges a sign-in link for tokens
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+	DeviceInfo
+}
+
+// FinishWebAuthnRegistrationRequest carries the credential returned by navigator.credentials.create()
+type FinishWebAuthnRegistrationRequest struct {
+	Name       string                        `json:"name" binding:"max=255"` // e.g. "iCloud Keychain"
+	Credential WebAuthnAttestationCredential `json:"credential"`
+}
+
+// FinishWebAuthnLoginRequest carries the credential returned by navigator.credentials.get()
+type FinishWebAuthnLoginRequest struct {
+	Credential WebAuthnAssertionCredential `json:"credential"`
+	DeviceInfo
+}
+
+// WebAuthnAttestationCredential is a PublicKeyCredential from a registration, with binary fields base64url-encoded
+type WebAuthnAttestationCredential struct {
+	ID       string                      `json:"id" binding:"required"`
+	Type     string                      `json:"type" binding:"required,eq=public-key"`
+	Response WebAuthnAttestationResponse `json:"response"`
+}
+
+type WebAuthnAttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AttestationObject string `json:"attestationObject" binding:"required"`
+}
+
+// WebAuthnAssertionCredential is a PublicKeyCredential from a login, with binary fields base64url-encoded
+type WebAuthnAssertionCredential struct {
+	ID       string                    `json:"id" binding:"required"`
+	Type     string                    `json:"type" binding:"required,eq=public-key"`
+	Response WebAuthnAssertionResponse `json:"response"`
+}
+
+type WebAuthnAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// DeviceInfo describes the client a login comes from. It is stored with the new session.
+type DeviceInfo struct {
+	DeviceName string `json:"deviceName" binding:"max=255"` // e.g. "Alice's iPhone"
+	Platform   string `json:"platform" binding:"max=50"`    // e.g. "ios", "android", "web"
+	AppVersion string `json:"appVersion" binding:"max=50"`
+	ClientIP   string `json:"-"` // Set by the handler
+	UserAgent  string `json:"-"` // Set by the handler
+}
+
+// OIDCCallbackRequest carries the parameters the identity provider redirected back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+	DeviceInfo
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" binding:"required_without=Code"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	ClientIP     string `json:"-"` // Set by the handler
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"` // Checked against the password policy
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type UpdateProfileRequest struct {
+	Name *string `json:"name" binding:"omitempty,min=1,max=255"` // Left unchanged if omitted
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"` // Checked against the password policy
+	ClientIP        string `json:"-"`                              // Set by the handler
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"newEmail" binding:"required,email,max=255"`
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	ClientIP        string `json:"-"` // Set by the handler
+}
+
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	OwnedLedgers    string `json:"ownedLedgers" binding:"omitempty,oneof=transfer delete"` // Defaults to "transfer"
+	ClientIP        string `json:"-"`                                                      // Set by the handler
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
 }
 
 type CreateLedgerRequest struct {
 	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
-	Currency    string `json:"currency" binding:"required"`
+	Description string `json:"description"`                                    // Defaults to the template's
+	Currency    string `json:"currency" binding:"required_without=TemplateID"` // Defaults to the template's
+	TemplateID  string `json:"templateId"`                                     // Template whose seed changes the ledger starts with
+}
+
+type ListLedgersRequest struct {
+	Cursor    string `form:"cursor"`
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=100"` // Defaults to 20
+	Sort      string `form:"sort" binding:"omitempty,oneof=lastActivity name createdAt"`
+	Order     string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Ownership string `form:"ownership" binding:"omitempty,oneof=owned shared"`
+	Currency  string `form:"currency" binding:"omitempty,len=3"`
+	Archived  string `form:"archived" binding:"omitempty,oneof=exclude include only"` // Defaults to "exclude"
+}
+
+type UpdateLedgerRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=255"` // Left unchanged if omitted
+	Description *string `json:"description"`                            // Left unchanged if omitted
+	Currency    *string `json:"currency"`                               // Left unchanged if omitted
+	IfMatch     string  `json:"-"`                                      // ETag the update is based on, set by the handler
+}
+
+type ForkLedgerRequest struct {
+	AtSequence *int64 `form:"atSequence" binding:"required,min=0"` // Last change of the source to copy
+	Name       string `form:"name" binding:"omitempty,max=255"`    // Defaults to the source's name followed by "(fork)"
+}
+
+type SaveLedgerTemplateRequest struct {
+	Name        string   `json:"name" binding:"required,max=255"`
+	Description string   `json:"description"`
+	Currency    string   `json:"currency"`
+	Statements  []string `json:"statements" binding:"max=500,dive,required"`
+	LedgerID    string   `json:"ledgerId" binding:"excluded_with=Statements"` // Copy the statements from this ledger's changes instead
 }
 
 type LedgerChangeRequest struct {
@@ -24,17 +190,61 @@ type LedgerChangeRequest struct {
 
 type AddUserToLedgerRequest struct {
 	Email       string `json:"email" binding:"required,email"`
-	Permissions string `json:"permissions" binding:"required,oneof=read write"`
+	Permissions string `json:"permissions" binding:"required,oneof=read write admin"`
+}
+
+type TransferLedgerRequest struct {
+	Email string `json:"email" binding:"required,email"` // Must be a member of the ledger
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=255"`
+	Permission    string   `json:"permission" binding:"required,oneof=read write"`
+	LedgerIDs     []string `json:"ledgerIds" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=365"` // Never expires if omitted
 }
 
 // Response models
 type AuthResponse struct {
-	Status    string `json:"status"`
-	UserID    string `json:"userId,omitempty"`
-	Email     string `json:"email,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Token     string `json:"token,omitempty"`
-	ExpiresIn int    `json:"expiresIn,omitempty"`
+	Status           string `json:"status"`
+	UserID           string `json:"userId,omitempty"`
+	Email            string `json:"email,omitempty"`
+	Name             string `json:"name,omitempty"`
+	Token            string `json:"token,omitempty"`
+	ExpiresIn        int    `json:"expiresIn,omitempty"`
+	RefreshToken     string `json:"refreshToken,omitempty"`
+	RefreshExpiresIn int    `json:"refreshExpiresIn,omitempty"`
+	MFARequired      bool   `json:"mfaRequired,omitempty"`
+	MFAToken         string `json:"mfaToken,omitempty"` // Challenge to exchange at /api/auth/login/mfa
+}
+
+type UserResponse struct {
+	Status string `json:"status"`
+	User   User   `json:"user"`
+}
+
+// PasswordViolation is a password policy rule the password failed
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicyErrorResponse struct {
+	Status     string              `json:"status"`
+	Code       string              `json:"code"`
+	Message    string              `json:"message"`
+	Violations []PasswordViolation `json:"violations"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Status     string `json:"status"`
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type RecoveryCodesResponse struct {
+	Status        string   `json:"status"`
+	RecoveryCodes []string `json:"recoveryCodes"`
 }
 
 type LedgerResponse struct {
@@ -45,6 +255,70 @@ type LedgerResponse struct {
 	InitialSequenceNumber int64  `json:"initialSequenceNumber,omitempty"`
 }
 
+type ListLedgersResponse struct {
+	Status     string          `json:"status"`
+	Ledgers    []LedgerSummary `json:"ledgers"`
+	NextCursor string          `json:"nextCursor,omitempty"` // Empty on the last page
+}
+
+type LedgerDetailsResponse struct {
+	Status          string          `json:"status"`
+	Ledger          Ledger          `json:"ledger"`
+	Owner           *LedgerMember   `json:"owner"` // null if the owner is no longer a member
+	Members         []LedgerMember  `json:"members"`
+	PendingTransfer *LedgerTransfer `json:"pendingTransfer,omitempty"` // Omitted unless a transfer awaits acceptance
+}
+
+type DeleteLedgerResponse struct {
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+	PurgeAt time.Time `json:"purgeAt"` // When the ledger is permanently deleted unless restored
+}
+
+// TrashedLedger is a deleted ledger that can still be restored
+type TrashedLedger struct {
+	Ledger
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+type TrashedLedgersResponse struct {
+	Status  string          `json:"status"`
+	Ledgers []TrashedLedger `json:"ledgers"`
+}
+
+type RestoreLedgerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Ledger  Ledger `json:"ledger"`
+}
+
+type UpdateLedgerResponse struct {
+	Status string `json:"status"`
+	Ledger Ledger `json:"ledger"`
+}
+
+type LedgerTransferResponse struct {
+	Status   string         `json:"status"`
+	Message  string         `json:"message"`
+	Transfer LedgerTransfer `json:"transfer"`
+}
+
+type LedgerTemplatesResponse struct {
+	Status    string           `json:"status"`
+	Templates []LedgerTemplate `json:"templates"`
+}
+
+type LedgerTemplateResponse struct {
+	Status   string         `json:"status"`
+	Template LedgerTemplate `json:"template"`
+}
+
+type LedgerEventsResponse struct {
+	Status   string        `json:"status"`
+	LedgerID string        `json:"ledgerId"`
+	Events   []LedgerEvent `json:"events"`
+}
+
 type LedgerChangeResponse struct {
 	Status                 string `json:"status"`
 	AssignedSequenceNumber int64  `json:"assignedSequenceNumber,omitempty"`
@@ -77,3 +351,127 @@ type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
+
+// JWK is a public signing key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+type CurrenciesResponse struct {
+	Status     string     `json:"status"`
+	Currencies []Currency `json:"currencies"`
+}
+
+type OIDCStartResponse struct {
+	Status           string `json:"status"`
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	Status      string              `json:"status"`
+	Token       string              `json:"token"` // Only shown once
+	AccessToken PersonalAccessToken `json:"accessToken"`
+}
+
+// WebAuthnRegistrationOptions are passed to navigator.credentials.create() as publicKey.
+// Binary fields are base64url-encoded.
+type WebAuthnRegistrationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUser                   `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"` // milliseconds
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnLoginOptions are passed to navigator.credentials.get() as publicKey.
+// AllowCredentials is empty, so the authenticator offers any passkey for the relying party.
+type WebAuthnLoginOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"` // milliseconds
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUser struct {
+	ID          string `json:"id"` // The user handle authenticators return on login
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type WebAuthnRegistrationStartResponse struct {
+	Status    string                      `json:"status"`
+	PublicKey WebAuthnRegistrationOptions `json:"publicKey"`
+}
+
+type WebAuthnLoginStartResponse struct {
+	Status    string               `json:"status"`
+	PublicKey WebAuthnLoginOptions `json:"publicKey"`
+}
+
+type WebAuthnCredentialResponse struct {
+	Status     string             `json:"status"`
+	Credential WebAuthnCredential `json:"credential"`
+}
+
+type WebAuthnCredentialsResponse struct {
+	Status      string               `json:"status"`
+	Credentials []WebAuthnCredential `json:"credentials"`
+}
+
+type ListPersonalAccessTokensResponse struct {
+	Status string                `json:"status"`
+	Tokens []PersonalAccessToken `json:"tokens"`
+}
+
+type SessionsResponse struct {
+	Status   string    `json:"status"`
+	Sessions []Session `json:"sessions"`
+}
+
+// UserDataExport is everything the server stores about a user, as returned by the data export
+type UserDataExport struct {
+	ExportedAt  time.Time            `json:"exportedAt"`
+	User        User                 `json:"user"`
+	Identities  []UserIdentity       `json:"identities"`
+	Sessions    []Session            `json:"sessions"`
+	Passkeys    []WebAuthnCredential `json:"passkeys"`
+	Memberships []LedgerMembership   `json:"memberships"`
+	Changes     []LedgerChange       `json:"changes"`
+	Templates   []LedgerTemplate     `json:"templates"`
+}
@@ -0,0 +1,106 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rongwang/COMP90018-server/internal/config"
+)
+
+// Hasher hashes and verifies passwords with one algorithm.
+// Every hash starts with a tag naming the algorithm that produced it.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Recognizes reports whether the hash carries this algorithm's tag
+	Recognizes(hash string) bool
+	// Verify checks the password against one of this algorithm's hashes. needsRehash reports
+	// whether the hash was made with weaker or different parameters than the hasher's own.
+	Verify(hash, password string) (ok, needsRehash bool, err error)
+}
+
+// Manager hashes new passwords with the configured algorithm and verifies hashes made by any
+// supported algorithm, so stored hashes can be upgraded as users sign in. It also enforces
+// the password policy.
+type Manager struct {
+	current Hasher
+	hashers []Hasher
+	policy  *Policy
+}
+
+// New creates a Manager that hashes with the algorithm and enforces the policy selected by the configuration
+func New(cfg config.PasswordConfig) (*Manager, error) {
+	policy, err := NewPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m.policy = policy
+	return m, nil
+}
+
+func newManager(cfg config.PasswordConfig) (*Manager, error) {
+	argon := NewArgon2idHasher(Argon2idParams{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+	bcryptHasher := NewBcryptHasher(cfg.BcryptCost)
+
+	switch cfg.Algorithm {
+	case "argon2id", "":
+		return NewManager(argon, bcryptHasher), nil
+	case "bcrypt":
+		return NewManager(bcryptHasher, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+}
+
+// NewManager creates a Manager that hashes with current and also accepts hashes from others
+func NewManager(current Hasher, others ...Hasher) *Manager {
+	return &Manager{
+		current: current,
+		hashers: append([]Hasher{current}, others...),
+	}
+}
+
+// Hash hashes the password with the current algorithm
+func (m *Manager) Hash(password string) (string, error) {
+	return m.current.Hash(password)
+}
+
+// Verify checks the password against a stored hash. needsRehash is only set for correct
+// passwords whose hash doesn't use the current algorithm and parameters.
+// An empty hash, as social-login-only accounts have, never matches.
+func (m *Manager) Verify(hash, password string) (ok, needsRehash bool, err error) {
+	if hash == "" {
+		return false, false, nil
+	}
+
+	for _, hasher := range m.hashers {
+		if !hasher.Recognizes(hash) {
+			continue
+		}
+
+		ok, needsRehash, err = hasher.Verify(hash, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, needsRehash || hasher != m.current, nil
+	}
+
+	return false, false, errors.New("unrecognized password hash format")
+}
+
+// CheckPolicy returns a *PolicyError if the password may not be used by the account
+func (m *Manager) CheckPolicy(password, email, name string) error {
+	if m.policy == nil {
+		return nil
+	}
+	return m.policy.Check(password, email, name)
+}
@@ -0,0 +1,220 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rongwang/COMP90018-server/internal/config"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// Rules a password can fail
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxLength     = "max_length"
+	RuleBreached      = "breached"
+	RuleContainsEmail = "contains_email"
+	RuleContainsName  = "contains_name"
+)
+
+// personalInfoMinLength keeps short names like "Al" from rejecting half of all passwords
+const personalInfoMinLength = 3
+
+var sha1LinePattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// PolicyError lists every rule a password failed
+type PolicyError struct {
+	Violations []models.PasswordViolation
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet the requirements"
+}
+
+// Policy decides which passwords users may choose
+type Policy struct {
+	minLength          int
+	maxLength          int
+	rejectPersonalInfo bool
+
+	// Breached passwords are looked up the way the k-anonymity range API works:
+	// by the first five hex characters of the SHA-1, then the remaining 35.
+	// Either ranges holds them in memory, or rangeDir holds one <PREFIX>.txt file per range.
+	ranges   map[string]map[string]struct{}
+	rangeDir string
+}
+
+// NewPolicy creates the policy selected by the configuration.
+// cfg.BlocklistFile may be a single file or a directory of range files.
+func NewPolicy(cfg config.PasswordConfig) (*Policy, error) {
+	p := &Policy{
+		minLength:          cfg.MinLength,
+		maxLength:          cfg.MaxLength,
+		rejectPersonalInfo: cfg.RejectPersonalInfo,
+	}
+
+	if cfg.BlocklistFile == "" {
+		return p, nil
+	}
+
+	info, err := os.Stat(cfg.BlocklistFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+
+	if info.IsDir() {
+		p.rangeDir = cfg.BlocklistFile
+		return p, nil
+	}
+
+	p.ranges, err = loadBlocklist(cfg.BlocklistFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check returns a *PolicyError if the password breaks any rule. email and name are the
+// account's, so users can't pick a password that is easy to guess from their profile.
+func (p *Policy) Check(password, email, name string) error {
+	var violations []models.PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, models.PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.minLength),
+		})
+	}
+
+	if p.maxLength > 0 && length > p.maxLength {
+		violations = append(violations, models.PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d characters long", p.maxLength),
+		})
+	}
+
+	if p.rejectPersonalInfo {
+		lower := strings.ToLower(password)
+
+		localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+		if len(localPart) >= personalInfoMinLength && strings.Contains(lower, localPart) {
+			violations = append(violations, models.PasswordViolation{
+				Rule:    RuleContainsEmail,
+				Message: "must not contain your email address",
+			})
+		}
+
+		for _, part := range strings.Fields(strings.ToLower(name)) {
+			if utf8.RuneCountInString(part) >= personalInfoMinLength && strings.Contains(lower, part) {
+				violations = append(violations, models.PasswordViolation{
+					Rule:    RuleContainsName,
+					Message: "must not contain your name",
+				})
+				break
+			}
+		}
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		return fmt.Errorf("error checking password blocklist: %w", err)
+	}
+
+	if breached {
+		violations = append(violations, models.PasswordViolation{
+			Rule:    RuleBreached,
+			Message: "is too common or has appeared in a data breach",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (p *Policy) isBreached(password string) (bool, error) {
+	if p.ranges == nil && p.rangeDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if p.ranges != nil {
+		_, found := p.ranges[prefix][suffix]
+		return found, nil
+	}
+
+	// A range file lists "SUFFIX:COUNT" lines for one prefix; missing files are empty ranges
+	file, err := os.Open(filepath.Join(p.rangeDir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// loadBlocklist reads a file of full SHA-1 hashes ("HASH" or "HASH:COUNT" per line) into ranges.
+// Lines that aren't SHA-1 hashes are taken as plaintext passwords, so lists of common
+// passwords can be used as they are. Empty lines and lines starting with # are skipped.
+func loadBlocklist(path string) (map[string]map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer file.Close()
+
+	ranges := make(map[string]map[string]struct{})
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var hash string
+		if sha1LinePattern.MatchString(line) {
+			hash = strings.ToUpper(line[:40])
+		} else {
+			sum := sha1.Sum([]byte(line))
+			hash = strings.ToUpper(hex.EncodeToString(sum[:]))
+		}
+
+		prefix, suffix := hash[:5], hash[5:]
+		if ranges[prefix] == nil {
+			ranges[prefix] = make(map[string]struct{})
+		}
+		ranges[prefix][suffix] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	return ranges, nil
+}
@@ -4,35 +4,142 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/rongwang/COMP90018-server/internal/models"
 )
 
+// Errors AddLedgerChange returns when the ledger stopped accepting changes
+var (
+	ErrLedgerArchived = errors.New("ledger is archived")
+	ErrLedgerTrashed  = errors.New("ledger is in the trash")
+)
+
+// ErrOwnedLedgersChanged is returned by DeleteUser when the user's ledgers or their successors
+// no longer match what the caller planned for, so that it can plan again
+var ErrOwnedLedgersChanged = errors.New("owned ledgers changed")
+
 // Repository interface defines the methods that any repository implementation must satisfy
 type Repository interface {
 	// User operations
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	UpdateUserPassword(ctx context.Context, userID, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID, email string) (bool, error)
+	IncrementTokenVersion(ctx context.Context, userID string) error
+	UpdateUserName(ctx context.Context, userID, name string) error
+	ChangeUserEmail(ctx context.Context, userID, email string) error
+	DeleteUser(ctx context.Context, userID string, transfers map[string]string, deleteLedgerIDs []string) error
+	GetUserIdentities(ctx context.Context, userID string) ([]models.UserIdentity, error)
 
 	// Ledger operations
-	CreateLedger(ctx context.Context, ledger *models.Ledger) error
-	DeleteLedger(ctx context.Context, ledgerID string) error
+	CreateLedger(ctx context.Context, ledger *models.Ledger, seed []models.LedgerChange) error
+	ForkLedger(ctx context.Context, ledger *models.Ledger, changes []models.LedgerChange, event *models.LedgerEvent) error
 	GetLedger(ctx context.Context, ledgerID string) (*models.Ledger, error)
-	GetUserLedgers(ctx context.Context, userID string) ([]models.Ledger, error)
+	GetUserLedgers(ctx context.Context, userID string, filter models.LedgerListFilter) ([]models.LedgerSummary, error)
+	GetOwnedLedgers(ctx context.Context, userID string) ([]models.Ledger, error)
+	GetLedgerMemberships(ctx context.Context, userID string) ([]models.LedgerMembership, error)
+	UpdateLedger(ctx context.Context, ledger *models.Ledger, expectedUpdatedAt time.Time, event *models.LedgerEvent) (bool, error)
+	GetLedgerEvents(ctx context.Context, ledgerID string, since time.Time) ([]models.LedgerEvent, error)
+	TrashLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error)
+	RestoreLedger(ctx context.Context, ledgerID string, trashedAfter time.Time, event *models.LedgerEvent) (bool, error)
+	GetTrashedLedgers(ctx context.Context, userID string) ([]models.Ledger, error)
+	ArchiveLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error)
+	UnarchiveLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error)
+	PurgeTrashedLedgers(ctx context.Context, trashedBefore time.Time) (int64, error)
 
 	// Ledger change operations
 	AddLedgerChange(ctx context.Context, change *models.LedgerChange) error
 	GetLedgerChangesBySequenceRange(ctx context.Context, ledgerID string, fromSeq, toSeq int64) ([]models.LedgerChange, error)
 	GetLatestSequenceNumber(ctx context.Context, ledgerID string) (int64, error)
+	GetUserLedgerChanges(ctx context.Context, userID string) ([]models.LedgerChange, error)
 
 	// Ledger sharing operations
 	AddUserToLedger(ctx context.Context, ledgerUser *models.LedgerUser) error
 	CheckLedgerAccess(ctx context.Context, ledgerID, userID string, requiredPermission string) (bool, error)
 	GetLedgerUsers(ctx context.Context, ledgerID string) ([]models.LedgerUser, error)
+	GetLedgerMembers(ctx context.Context, ledgerID string) ([]models.LedgerMember, error)
+
+	// Ledger template operations
+	CreateLedgerTemplate(ctx context.Context, template *models.LedgerTemplate) error
+	GetLedgerTemplate(ctx context.Context, templateID string) (*models.LedgerTemplate, error)
+	GetLedgerTemplates(ctx context.Context, userID string) ([]models.LedgerTemplate, error)
+	DeleteLedgerTemplate(ctx context.Context, userID, templateID string) (bool, error)
+
+	// Ledger ownership transfer operations
+	SaveLedgerTransfer(ctx context.Context, transfer *models.LedgerTransfer) error
+	GetLedgerTransfer(ctx context.Context, ledgerID string) (*models.LedgerTransfer, error)
+	DeleteLedgerTransfer(ctx context.Context, ledgerID string) error
+	CompleteLedgerTransfer(ctx context.Context, transfer *models.LedgerTransfer, event *models.LedgerEvent) (bool, error)
+
+	// Refresh token operations
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldTokenID string, newToken *models.RefreshToken) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+
+	// Access token revocation operations
+	RevokeAccessToken(ctx context.Context, jti, userID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	// Single-use token operations
+	CreateAuthToken(ctx context.Context, token *models.AuthToken) error
+	GetAuthToken(ctx context.Context, tokenHash, purpose string) (*models.AuthToken, error)
+	ConsumeAuthToken(ctx context.Context, tokenHash, purpose string) (*models.AuthToken, error)
+	InvalidateAuthTokens(ctx context.Context, userID, purpose string) error
+
+	// Two-factor authentication operations
+	GetUserMFA(ctx context.Context, userID string) (*models.UserMFA, error)
+	SaveTOTPSecret(ctx context.Context, userID, secret string) error
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodes []models.MFARecoveryCode) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	DeleteUserMFA(ctx context.Context, userID string) error
+
+	// Login throttling operations
+	GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, key string, windowStart time.Time) (int, error)
+	LockLoginThrottle(ctx context.Context, key string, until time.Time) error
+	ClearLoginThrottle(ctx context.Context, key string) error
+	HitRateLimit(ctx context.Context, key string, windowStart time.Time) (*models.RateLimit, error)
+
+	// Social login operations
+	CreateOIDCState(ctx context.Context, state *models.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash, provider string) (*models.OIDCState, error)
+	GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error
+	CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error
+
+	// Personal access token operations
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) (bool, error)
+	TouchPersonalAccessToken(ctx context.Context, tokenID string) error
+
+	// Session operations
+	CreateSession(ctx context.Context, session *models.Session) error
+	TouchSession(ctx context.Context, sessionID, ipAddress string) error
+	ListActiveSessions(ctx context.Context, userID string, seenSince time.Time) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID string) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error
+
+	// Passkey operations
+	CreateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(ctx context.Context, challengeHash, ceremony string) (*models.WebAuthnChallenge, error)
+	CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id string, signCount int64) (bool, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID, id string) (bool, error)
 }
 
 // PostgresRepository implements the Repository interface using PostgreSQL
@@ -104,8 +211,53 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id string) (*model
 	return &user, nil
 }
 
-// Ledger repository methods
-func (r *PostgresRepository) CreateLedger(ctx context.Context, ledger *models.Ledger) error {
+func (r *PostgresRepository) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	_, err := r.db.ExecContext(ctx, query, passwordHash, time.Now().UTC(), userID)
+	return err
+}
+
+// MarkEmailVerified records that the user verified the address.
+// It returns false if the user's email is no longer the address that was verified.
+func (r *PostgresRepository) MarkEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+	query := `UPDATE users SET email_verified_at = $1, updated_at = $1 WHERE id = $2 AND email = $3`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID, email)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r *PostgresRepository) UpdateUserName(ctx context.Context, userID, name string) error {
+	query := `UPDATE users SET name = $1, updated_at = $2 WHERE id = $3`
+
+	_, err := r.db.ExecContext(ctx, query, name, time.Now().UTC(), userID)
+	return err
+}
+
+// ChangeUserEmail switches the user to an address they have just confirmed, so it is stored as verified
+func (r *PostgresRepository) ChangeUserEmail(ctx context.Context, userID, email string) error {
+	query := `UPDATE users SET email = $1, email_verified_at = $2, updated_at = $2 WHERE id = $3`
+
+	_, err := r.db.ExecContext(ctx, query, email, time.Now().UTC(), userID)
+	return err
+}
+
+// DeleteUser deletes the account in one transaction. Owned ledgers are handed to the member
+// in transfers (ledger ID to new owner ID) or deleted. Everything else the user has is removed
+// by foreign key cascades, and their ledger changes are kept with the author set to NULL.
+// Each transfer is recorded as an owner_changed event on the ledger.
+// Every ledger the user owns must be in transfers or deleteLedgerIDs, and every new owner must
+// still be able to write to their ledger, or ErrOwnedLedgersChanged is returned.
+func (r *PostgresRepository) DeleteUser(ctx context.Context, userID string, transfers map[string]string, deleteLedgerIDs []string) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -118,45 +270,158 @@ func (r *PostgresRepository) CreateLedger(ctx context.Context, ledger *models.Le
 		}
 	}()
 
-	query := `
-		INSERT INTO ledgers (id, name, description, currency, created_by, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
+	now := time.Now().UTC()
 
-	// Generate a new UUID if not provided
-	if ledger.ID == "" {
-		ledger.ID = uuid.New().String()
+	// Lock the owned ledgers so none can be created or handed to the user until the account is
+	// gone. A ledger missing from the plan would otherwise be deleted by the cascade.
+	var ownedIDs []string
+	err = func() error {
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM ledgers WHERE created_by = $1 FOR UPDATE`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ownedIDs = append(ownedIDs, id)
+		}
+		return rows.Err()
+	}()
+	if err != nil {
+		return err
 	}
 
-	now := time.Now().UTC()
-	ledger.CreatedAt = now
-	ledger.UpdatedAt = now
+	planned := make(map[string]bool, len(transfers)+len(deleteLedgerIDs))
+	for ledgerID := range transfers {
+		planned[ledgerID] = true
+	}
+	for _, ledgerID := range deleteLedgerIDs {
+		planned[ledgerID] = true
+	}
 
-	_, err = tx.ExecContext(ctx, query,
-		ledger.ID, ledger.Name, ledger.Description, ledger.Currency,
-		ledger.CreatedBy, ledger.CreatedAt, ledger.UpdatedAt)
+	if len(ownedIDs) != len(planned) {
+		err = ErrOwnedLedgersChanged
+		return err
+	}
+	for _, ledgerID := range ownedIDs {
+		if !planned[ledgerID] {
+			err = ErrOwnedLedgersChanged
+			return err
+		}
+	}
+
+	for ledgerID, newOwnerID := range transfers {
+		// Keep the new owner's membership from being removed before the commit
+		var permissions string
+		err = tx.QueryRowContext(ctx,
+			`SELECT permissions FROM ledger_users WHERE ledger_id = $1 AND user_id = $2 FOR SHARE`,
+			ledgerID, newOwnerID).Scan(&permissions)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && permissions == "read") {
+			err = ErrOwnedLedgersChanged
+		}
+		if err != nil {
+			return err
+		}
+
+		var result sql.Result
+		result, err = tx.ExecContext(ctx,
+			`UPDATE ledgers SET created_by = $1, updated_at = $2 WHERE id = $3 AND created_by = $4`,
+			newOwnerID, now, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+
+		var rows int64
+		rows, err = result.RowsAffected()
+		if err == nil && rows == 0 {
+			err = ErrOwnedLedgersChanged
+		}
+		if err != nil {
+			return err
+		}
 
+		// Record the handoff in the ledger's history like any other ownership change.
+		// The event's user becomes NULL with the account.
+		err = r.createLedgerEventTx(ctx, tx, &models.LedgerEvent{
+			ID:        uuid.New().String(),
+			LedgerID:  ledgerID,
+			UserID:    &userID,
+			Type:      models.LedgerEventOwnerChanged,
+			Details:   models.LedgerEventDetails{"from": userID, "to": newOwnerID},
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ledgerID := range deleteLedgerIDs {
+		_, err = tx.ExecContext(ctx, `DELETE FROM ledgers WHERE id = $1 AND created_by = $2`, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
 	if err != nil {
 		return err
 	}
 
-	// Add the creator as a user with write permissions
-	ledgerUser := &models.LedgerUser{
-		LedgerID:    ledger.ID,
-		UserID:      ledger.CreatedBy,
-		Permissions: "write",
-		CreatedAt:   now,
+	err = tx.Commit()
+	return err
+}
+
+// IncrementTokenVersion invalidates every token issued to the user before the call
+func (r *PostgresRepository) IncrementTokenVersion(ctx context.Context, userID string) error {
+	query := `UPDATE users SET token_version = token_version + 1, updated_at = $1 WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID)
+	return err
+}
+
+// Ledger repository methods
+// CreateLedger creates the ledger with the seed changes as its first sequence numbers.
+// The seed changes must be numbered from 1.
+func (r *PostgresRepository) CreateLedger(ctx context.Context, ledger *models.Ledger, seed []models.LedgerChange) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
 
-	err = r.addUserToLedgerTx(ctx, tx, ledgerUser)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	err = r.createLedgerTx(ctx, tx, ledger)
 	if err != nil {
 		return err
 	}
 
+	if len(seed) > 0 {
+		err = r.addLedgerChangesTx(ctx, tx, ledger.ID, seed)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
-func (r *PostgresRepository) DeleteLedger(ctx context.Context, ledgerID string) error {
+// ForkLedger creates the ledger with the given change log, copied from another ledger, and
+// records the event on it. The changes must already be numbered from 1.
+func (r *PostgresRepository) ForkLedger(
+	ctx context.Context,
+	ledger *models.Ledger,
+	changes []models.LedgerChange,
+	event *models.LedgerEvent,
+) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -169,20 +434,18 @@ func (r *PostgresRepository) DeleteLedger(ctx context.Context, ledgerID string)
 		}
 	}()
 
-	// Delete ledger users first (due to foreign key constraint)
-	_, err = tx.ExecContext(ctx, `DELETE FROM ledger_users WHERE ledger_id = $1`, ledgerID)
+	err = r.createLedgerTx(ctx, tx, ledger)
 	if err != nil {
 		return err
 	}
 
-	// Delete ledger changes
-	_, err = tx.ExecContext(ctx, `DELETE FROM ledger_changes WHERE ledger_id = $1`, ledgerID)
+	err = r.addLedgerChangesTx(ctx, tx, ledger.ID, changes)
 	if err != nil {
 		return err
 	}
 
-	// Delete the ledger
-	_, err = tx.ExecContext(ctx, `DELETE FROM ledgers WHERE id = $1`, ledgerID)
+	event.LedgerID = ledger.ID
+	err = r.createLedgerEventTx(ctx, tx, event)
 	if err != nil {
 		return err
 	}
@@ -190,6 +453,83 @@ func (r *PostgresRepository) DeleteLedger(ctx context.Context, ledgerID string)
 	return tx.Commit()
 }
 
+// createLedgerTx inserts the ledger and adds its creator as a user with write permissions
+func (r *PostgresRepository) createLedgerTx(ctx context.Context, tx *sql.Tx, ledger *models.Ledger) error {
+	query := `
+		INSERT INTO ledgers (id, name, description, currency, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	// Generate a new UUID if not provided
+	if ledger.ID == "" {
+		ledger.ID = uuid.New().String()
+	}
+
+	now := time.Now().UTC()
+	ledger.CreatedAt = now
+	ledger.UpdatedAt = now
+
+	_, err := tx.ExecContext(ctx, query,
+		ledger.ID, ledger.Name, ledger.Description, ledger.Currency,
+		ledger.CreatedBy, ledger.CreatedAt, ledger.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	// Add the creator as a user with write permissions
+	ledgerUser := &models.LedgerUser{
+		LedgerID:    ledger.ID,
+		UserID:      ledger.CreatedBy,
+		Permissions: "write",
+		CreatedAt:   now,
+	}
+
+	return r.addUserToLedgerTx(ctx, tx, ledgerUser)
+}
+
+// addLedgerChangesTx writes the initial change log of a new ledger and moves its sequence to
+// the last change. The changes keep the sequence numbers they are given.
+func (r *PostgresRepository) addLedgerChangesTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	ledgerID string,
+	changes []models.LedgerChange,
+) error {
+	query := `
+		INSERT INTO ledger_changes (id, ledger_id, user_id, sequence_number, sql_statement, timestamp, base_sequence_number)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	var latestSeq int64
+	for i := range changes {
+		change := &changes[i]
+		change.LedgerID = ledgerID
+
+		// Generate a new UUID if not provided
+		if change.ID == "" {
+			change.ID = uuid.New().String()
+		}
+
+		_, err := tx.ExecContext(ctx, query,
+			change.ID, change.LedgerID, change.UserID, change.SequenceNumber,
+			change.SQLStatement, change.Timestamp, change.BaseSequenceNum)
+		if err != nil {
+			return err
+		}
+
+		if change.SequenceNumber > latestSeq {
+			latestSeq = change.SequenceNumber
+		}
+	}
+
+	// The sequence row itself is created by a trigger when the ledger is inserted
+	_, err := tx.ExecContext(ctx,
+		`UPDATE ledger_sequences SET current_sequence = $1 WHERE ledger_id = $2`,
+		latestSeq, ledgerID)
+	return err
+}
+
 func (r *PostgresRepository) GetLedger(ctx context.Context, ledgerID string) (*models.Ledger, error) {
 	query := `SELECT * FROM ledgers WHERE id = $1`
 
@@ -205,12 +545,87 @@ func (r *PostgresRepository) GetLedger(ctx context.Context, ledgerID string) (*m
 	return &ledger, nil
 }
 
-func (r *PostgresRepository) GetUserLedgers(ctx context.Context, userID string) ([]models.Ledger, error) {
+// ledgerSortColumns maps the sorts GetUserLedgers accepts to the columns they order by
+var ledgerSortColumns = map[string]string{
+	"lastActivity": "last_activity_at",
+	"name":         "name",
+	"createdAt":    "created_at",
+}
+
+// GetUserLedgers returns a page of the ledgers the user belongs to. Pages are keyed on the
+// sort column and the ledger ID, so they don't shift when ledgers are added or removed.
+func (r *PostgresRepository) GetUserLedgers(ctx context.Context, userID string, filter models.LedgerListFilter) ([]models.LedgerSummary, error) {
+	column, ok := ledgerSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown ledger sort %q", filter.Sort)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// The latest change is found through ledger_sequences, which avoids scanning every change
 	query := `
-		SELECT l.* FROM ledgers l
-		JOIN ledger_users lu ON l.id = lu.ledger_id
-		WHERE lu.user_id = $1
-	`
+		SELECT * FROM (
+			SELECT l.*, lu.permissions, l.created_by = lu.user_id AS owner,
+				(SELECT COUNT(*) FROM ledger_users m WHERE m.ledger_id = l.id) AS member_count,
+				COALESCE(ls.current_sequence, 0) AS latest_sequence_number,
+				GREATEST(l.updated_at, lc.timestamp) AS last_activity_at
+			FROM ledger_users lu
+			JOIN ledgers l ON l.id = lu.ledger_id
+			LEFT JOIN ledger_sequences ls ON ls.ledger_id = l.id
+			LEFT JOIN ledger_changes lc ON lc.ledger_id = l.id AND lc.sequence_number = ls.current_sequence
+			WHERE lu.user_id = $1 AND l.deleted_at IS NULL
+		) summaries
+		WHERE TRUE`
+
+	args := []interface{}{userID}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	switch filter.Ownership {
+	case "owned":
+		query += " AND owner"
+	case "shared":
+		query += " AND NOT owner"
+	}
+
+	if filter.Currency != "" {
+		query += " AND UPPER(currency) = UPPER(" + param(filter.Currency) + ")"
+	}
+
+	switch filter.Archived {
+	case "exclude":
+		query += " AND archived_at IS NULL"
+	case "only":
+		query += " AND archived_at IS NOT NULL"
+	}
+
+	if filter.LedgerIDs != nil {
+		query += " AND id = ANY(" + param(pq.Array(filter.LedgerIDs)) + ")"
+	}
+
+	if filter.AfterValue != nil {
+		query += fmt.Sprintf(" AND (%s, id) %s (%s, %s)", column, comparison, param(filter.AfterValue), param(filter.AfterID))
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, direction, direction, param(filter.Limit))
+
+	var ledgers []models.LedgerSummary
+	err := r.db.SelectContext(ctx, &ledgers, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgers, nil
+}
+
+// GetOwnedLedgers returns the ledgers the user created
+func (r *PostgresRepository) GetOwnedLedgers(ctx context.Context, userID string) ([]models.Ledger, error) {
+	query := `SELECT * FROM ledgers WHERE created_by = $1`
 
 	var ledgers []models.Ledger
 	err := r.db.SelectContext(ctx, &ledgers, query, userID)
@@ -221,12 +636,37 @@ func (r *PostgresRepository) GetUserLedgers(ctx context.Context, userID string)
 	return ledgers, nil
 }
 
-// Ledger change repository methods
-func (r *PostgresRepository) AddLedgerChange(ctx context.Context, change *models.LedgerChange) error {
-	// Start a regular transaction - no need for serializable since we're using a dedicated sequence table
+// GetLedgerMemberships returns every ledger the user belongs to with their permission on it
+func (r *PostgresRepository) GetLedgerMemberships(ctx context.Context, userID string) ([]models.LedgerMembership, error) {
+	query := `
+		SELECT l.id AS ledger_id, l.name, l.currency, l.created_by = lu.user_id AS owner,
+			lu.permissions, lu.created_at AS joined_at
+		FROM ledger_users lu
+		JOIN ledgers l ON l.id = lu.ledger_id
+		WHERE lu.user_id = $1
+		ORDER BY lu.created_at
+	`
+
+	var memberships []models.LedgerMembership
+	err := r.db.SelectContext(ctx, &memberships, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// UpdateLedger saves the ledger's name, description, currency and updated_at and records the
+// event, unless the ledger was updated by someone else since expectedUpdatedAt
+func (r *PostgresRepository) UpdateLedger(
+	ctx context.Context,
+	ledger *models.Ledger,
+	expectedUpdatedAt time.Time,
+	event *models.LedgerEvent,
+) (bool, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	defer func() {
@@ -236,79 +676,284 @@ func (r *PostgresRepository) AddLedgerChange(ctx context.Context, change *models
 		}
 	}()
 
-	// Get and increment the sequence number atomically
-	var nextSeq int64
+	// Lock the ledger so that the check and the update can't interleave with another update
+	var updatedAt time.Time
 	err = tx.QueryRowContext(ctx,
-		`UPDATE ledger_sequences 
-		SET current_sequence = current_sequence + 1 
-		WHERE ledger_id = $1 
-		RETURNING current_sequence`,
-		change.LedgerID).Scan(&nextSeq)
+		`SELECT updated_at FROM ledgers WHERE id = $1 FOR UPDATE`,
+		ledger.ID).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Rollback()
+		return false, err
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	change.SequenceNumber = nextSeq
-
-	// Generate a new UUID if not provided
-	if change.ID == "" {
-		change.ID = uuid.New().String()
+	if !updatedAt.Equal(expectedUpdatedAt) {
+		err = tx.Rollback()
+		return false, err
 	}
 
-	// Set timestamp if not provided
-	if change.Timestamp.IsZero() {
-		change.Timestamp = time.Now().UTC()
+	_, err = tx.ExecContext(ctx,
+		`UPDATE ledgers SET name = $1, description = $2, currency = $3, updated_at = $4 WHERE id = $5`,
+		ledger.Name, ledger.Description, ledger.Currency, ledger.UpdatedAt, ledger.ID)
+	if err != nil {
+		return false, err
 	}
 
-	// Insert the change with the next sequence number
-	query := `
-		INSERT INTO ledger_changes (id, ledger_id, user_id, sequence_number, sql_statement, timestamp, base_sequence_number)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-
-	_, err = tx.ExecContext(ctx, query,
-		change.ID, change.LedgerID, change.UserID, change.SequenceNumber,
-		change.SQLStatement, change.Timestamp, change.BaseSequenceNum)
-
+	err = r.createLedgerEventTx(ctx, tx, event)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return tx.Commit()
+	return true, tx.Commit()
 }
 
-func (r *PostgresRepository) GetLedgerChangesBySequenceRange(
-	ctx context.Context,
-	ledgerID string,
-	fromSeq,
-	toSeq int64,
-) ([]models.LedgerChange, error) {
+func (r *PostgresRepository) createLedgerEventTx(ctx context.Context, tx *sql.Tx, event *models.LedgerEvent) error {
 	query := `
-		SELECT * FROM ledger_changes 
-		WHERE ledger_id = $1 AND sequence_number >= $2
+		INSERT INTO ledger_events (id, ledger_id, user_id, type, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
-	args := []interface{}{ledgerID, fromSeq}
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
 
-	// Add toSeq condition if provided
-	if toSeq > 0 {
-		query += ` AND sequence_number <= $3`
-		args = append(args, toSeq)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
 	}
 
-	query += ` ORDER BY sequence_number ASC`
+	_, err := tx.ExecContext(ctx, query,
+		event.ID, event.LedgerID, event.UserID, event.Type, event.Details, event.CreatedAt)
+	return err
+}
 
-	var changes []models.LedgerChange
-	err := r.db.SelectContext(ctx, &changes, query, args...)
+// GetLedgerEvents returns the ledger's events recorded after since, oldest first
+func (r *PostgresRepository) GetLedgerEvents(ctx context.Context, ledgerID string, since time.Time) ([]models.LedgerEvent, error) {
+	query := `SELECT * FROM ledger_events WHERE ledger_id = $1 AND created_at > $2 ORDER BY created_at, id`
+
+	var events []models.LedgerEvent
+	err := r.db.SelectContext(ctx, &events, query, ledgerID, since)
 	if err != nil {
 		return nil, err
 	}
 
-	return changes, nil
+	return events, nil
 }
 
-func (r *PostgresRepository) GetLatestSequenceNumber(ctx context.Context, ledgerID string) (int64, error) {
-	query := `SELECT current_sequence FROM ledger_sequences WHERE ledger_id = $1`
+// TrashLedger moves the ledger to the trash at the event's time, hiding it from its members.
+// It returns false if the ledger is already in the trash.
+func (r *PostgresRepository) TrashLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error) {
+	return r.updateLedgerState(ctx, event,
+		`UPDATE ledgers SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`,
+		event.CreatedAt, ledgerID)
+}
+
+// RestoreLedger takes the ledger out of the trash if it was moved there after trashedAfter
+func (r *PostgresRepository) RestoreLedger(
+	ctx context.Context,
+	ledgerID string,
+	trashedAfter time.Time,
+	event *models.LedgerEvent,
+) (bool, error) {
+	return r.updateLedgerState(ctx, event,
+		`UPDATE ledgers SET deleted_at = NULL WHERE id = $1 AND deleted_at > $2`,
+		ledgerID, trashedAfter)
+}
+
+// ArchiveLedger makes the ledger read-only at the event's time. It returns false if the
+// ledger is already archived.
+func (r *PostgresRepository) ArchiveLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error) {
+	return r.updateLedgerState(ctx, event,
+		`UPDATE ledgers SET archived_at = $1 WHERE id = $2 AND archived_at IS NULL`,
+		event.CreatedAt, ledgerID)
+}
+
+// UnarchiveLedger makes the ledger writable again. It returns false if the ledger isn't archived.
+func (r *PostgresRepository) UnarchiveLedger(ctx context.Context, ledgerID string, event *models.LedgerEvent) (bool, error) {
+	return r.updateLedgerState(ctx, event,
+		`UPDATE ledgers SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL`,
+		ledgerID)
+}
+
+// updateLedgerState runs an update of a single ledger and records the event in the same
+// transaction. It returns false, and records nothing, if the update matched no ledger.
+func (r *PostgresRepository) updateLedgerState(
+	ctx context.Context,
+	event *models.LedgerEvent,
+	query string,
+	args ...interface{},
+) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		err = tx.Rollback()
+		return false, err
+	}
+
+	err = r.createLedgerEventTx(ctx, tx, event)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetTrashedLedgers returns the user's ledgers that are in the trash, most recently deleted first
+func (r *PostgresRepository) GetTrashedLedgers(ctx context.Context, userID string) ([]models.Ledger, error) {
+	query := `SELECT * FROM ledgers WHERE created_by = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+
+	var ledgers []models.Ledger
+	err := r.db.SelectContext(ctx, &ledgers, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgers, nil
+}
+
+// PurgeTrashedLedgers permanently deletes the ledgers moved to the trash before trashedBefore,
+// with their members and changes
+func (r *PostgresRepository) PurgeTrashedLedgers(ctx context.Context, trashedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM ledgers WHERE deleted_at <= $1`, trashedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Ledger change repository methods
+func (r *PostgresRepository) AddLedgerChange(ctx context.Context, change *models.LedgerChange) error {
+	// Start a regular transaction - no need for serializable since we're using a dedicated sequence table
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	// Lock the ledger for the rest of the transaction so that it can't be archived or
+	// trashed before the change is committed. FOR SHARE still lets changes run in parallel.
+	var archivedAt, deletedAt *time.Time
+	err = tx.QueryRowContext(ctx,
+		`SELECT archived_at, deleted_at FROM ledgers WHERE id = $1 FOR SHARE`,
+		change.LedgerID).Scan(&archivedAt, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrLedgerTrashed
+	}
+	if err != nil {
+		return err
+	}
+
+	if deletedAt != nil {
+		err = ErrLedgerTrashed
+		return err
+	}
+
+	if archivedAt != nil {
+		err = ErrLedgerArchived
+		return err
+	}
+
+	// Get and increment the sequence number atomically
+	var nextSeq int64
+	err = tx.QueryRowContext(ctx,
+		`UPDATE ledger_sequences 
+		SET current_sequence = current_sequence + 1 
+		WHERE ledger_id = $1 
+		RETURNING current_sequence`,
+		change.LedgerID).Scan(&nextSeq)
+	if err != nil {
+		return err
+	}
+
+	change.SequenceNumber = nextSeq
+
+	// Generate a new UUID if not provided
+	if change.ID == "" {
+		change.ID = uuid.New().String()
+	}
+
+	// Set timestamp if not provided
+	if change.Timestamp.IsZero() {
+		change.Timestamp = time.Now().UTC()
+	}
+
+	// Insert the change with the next sequence number
+	query := `
+		INSERT INTO ledger_changes (id, ledger_id, user_id, sequence_number, sql_statement, timestamp, base_sequence_number)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		change.ID, change.LedgerID, change.UserID, change.SequenceNumber,
+		change.SQLStatement, change.Timestamp, change.BaseSequenceNum)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) GetLedgerChangesBySequenceRange(
+	ctx context.Context,
+	ledgerID string,
+	fromSeq,
+	toSeq int64,
+) ([]models.LedgerChange, error) {
+	query := `
+		SELECT * FROM ledger_changes 
+		WHERE ledger_id = $1 AND sequence_number >= $2
+	`
+
+	args := []interface{}{ledgerID, fromSeq}
+
+	// Add toSeq condition if provided
+	if toSeq > 0 {
+		query += ` AND sequence_number <= $3`
+		args = append(args, toSeq)
+	}
+
+	query += ` ORDER BY sequence_number ASC`
+
+	var changes []models.LedgerChange
+	err := r.db.SelectContext(ctx, &changes, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (r *PostgresRepository) GetLatestSequenceNumber(ctx context.Context, ledgerID string) (int64, error) {
+	query := `SELECT current_sequence FROM ledger_sequences WHERE ledger_id = $1`
 
 	var seqNum int64
 	err := r.db.GetContext(ctx, &seqNum, query, ledgerID)
@@ -382,10 +1027,18 @@ func (r *PostgresRepository) CheckLedgerAccess(
 	userID string,
 	requiredPermission string,
 ) (bool, error) {
-	query := `SELECT permissions FROM ledger_users WHERE ledger_id = $1 AND user_id = $2`
+	query := `
+		SELECT lu.permissions, l.created_by = lu.user_id AS owner
+		FROM ledger_users lu
+		JOIN ledgers l ON l.id = lu.ledger_id
+		WHERE lu.ledger_id = $1 AND lu.user_id = $2 AND l.deleted_at IS NULL
+	`
 
-	var permission string
-	err := r.db.GetContext(ctx, &permission, query, ledgerID, userID)
+	var access struct {
+		Permissions string `db:"permissions"`
+		Owner       bool   `db:"owner"`
+	}
+	err := r.db.GetContext(ctx, &access, query, ledgerID, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false, nil // No access
@@ -393,10 +1046,13 @@ func (r *PostgresRepository) CheckLedgerAccess(
 		return false, err
 	}
 
-	// If write permission is required, check if user has write permission
-	// If read permission is required, both read and write permissions are sufficient
-	if requiredPermission == "write" {
-		return permission == "write", nil
+	// Each permission includes the ones below it: read < write < admin.
+	// The owner can always administer their ledger.
+	switch requiredPermission {
+	case "admin":
+		return access.Owner || access.Permissions == "admin", nil
+	case "write":
+		return access.Owner || access.Permissions == "write" || access.Permissions == "admin", nil
 	}
 
 	return true, nil // User has access
@@ -413,3 +1069,1162 @@ func (r *PostgresRepository) GetLedgerUsers(ctx context.Context, ledgerID string
 
 	return ledgerUsers, nil
 }
+
+// GetLedgerMembers returns the ledger's users with their names and emails, longest-standing first
+func (r *PostgresRepository) GetLedgerMembers(ctx context.Context, ledgerID string) ([]models.LedgerMember, error) {
+	query := `
+		SELECT lu.user_id, u.name, u.email, lu.permissions, l.created_by = lu.user_id AS owner,
+			lu.created_at AS joined_at
+		FROM ledger_users lu
+		JOIN users u ON u.id = lu.user_id
+		JOIN ledgers l ON l.id = lu.ledger_id
+		WHERE lu.ledger_id = $1
+		ORDER BY lu.created_at, lu.user_id
+	`
+
+	var members []models.LedgerMember
+	err := r.db.SelectContext(ctx, &members, query, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Ledger template repository methods
+func (r *PostgresRepository) CreateLedgerTemplate(ctx context.Context, template *models.LedgerTemplate) error {
+	query := `
+		INSERT INTO ledger_templates (id, user_id, name, description, currency, statements, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		template.ID, template.UserID, template.Name, template.Description,
+		template.Currency, template.Statements, template.CreatedAt)
+	return err
+}
+
+func (r *PostgresRepository) GetLedgerTemplate(ctx context.Context, templateID string) (*models.LedgerTemplate, error) {
+	query := `SELECT * FROM ledger_templates WHERE id = $1`
+
+	var template models.LedgerTemplate
+	err := r.db.GetContext(ctx, &template, query, templateID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Template not found
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// GetLedgerTemplates returns the templates the user has saved, oldest first
+func (r *PostgresRepository) GetLedgerTemplates(ctx context.Context, userID string) ([]models.LedgerTemplate, error) {
+	query := `SELECT * FROM ledger_templates WHERE user_id = $1 ORDER BY created_at, id`
+
+	var templates []models.LedgerTemplate
+	err := r.db.SelectContext(ctx, &templates, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// DeleteLedgerTemplate returns false if the user has no such template
+func (r *PostgresRepository) DeleteLedgerTemplate(ctx context.Context, userID, templateID string) (bool, error) {
+	query := `DELETE FROM ledger_templates WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, templateID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Ledger ownership transfer repository methods
+
+// SaveLedgerTransfer stores the proposed transfer, replacing any other pending on the ledger
+func (r *PostgresRepository) SaveLedgerTransfer(ctx context.Context, transfer *models.LedgerTransfer) error {
+	query := `
+		INSERT INTO ledger_transfers (ledger_id, from_user_id, to_user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ledger_id) DO UPDATE
+		SET from_user_id = EXCLUDED.from_user_id, to_user_id = EXCLUDED.to_user_id,
+			expires_at = EXCLUDED.expires_at, created_at = EXCLUDED.created_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		transfer.LedgerID, transfer.FromUserID, transfer.ToUserID, transfer.ExpiresAt, transfer.CreatedAt)
+	return err
+}
+
+func (r *PostgresRepository) GetLedgerTransfer(ctx context.Context, ledgerID string) (*models.LedgerTransfer, error) {
+	query := `SELECT * FROM ledger_transfers WHERE ledger_id = $1`
+
+	var transfer models.LedgerTransfer
+	err := r.db.GetContext(ctx, &transfer, query, ledgerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No pending transfer
+		}
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+func (r *PostgresRepository) DeleteLedgerTransfer(ctx context.Context, ledgerID string) error {
+	query := `DELETE FROM ledger_transfers WHERE ledger_id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, ledgerID)
+	return err
+}
+
+// CompleteLedgerTransfer makes the transfer's recipient the owner of the ledger and records the
+// event. The previous owner stays on as an admin, and a recipient with read access is given
+// write access like any owner. It returns false, changing nothing, if the transfer is no longer
+// pending or the ledger has changed hands in the meantime.
+func (r *PostgresRepository) CompleteLedgerTransfer(
+	ctx context.Context,
+	transfer *models.LedgerTransfer,
+	event *models.LedgerEvent,
+) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM ledger_transfers
+		WHERE ledger_id = $1 AND from_user_id = $2 AND to_user_id = $3 AND expires_at > $4
+	`, transfer.LedgerID, transfer.FromUserID, transfer.ToUserID, event.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		err = tx.Rollback()
+		return false, err
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		UPDATE ledgers SET created_by = $1, updated_at = $2
+		WHERE id = $3 AND created_by = $4 AND deleted_at IS NULL
+	`, transfer.ToUserID, event.CreatedAt, transfer.LedgerID, transfer.FromUserID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		err = tx.Rollback()
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE ledger_users SET permissions = 'admin' WHERE ledger_id = $1 AND user_id = $2`,
+		transfer.LedgerID, transfer.FromUserID)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE ledger_users SET permissions = 'write' WHERE ledger_id = $1 AND user_id = $2 AND permissions = 'read'`,
+		transfer.LedgerID, transfer.ToUserID)
+	if err != nil {
+		return false, err
+	}
+
+	err = r.createLedgerEventTx(ctx, tx, event)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Refresh token repository methods
+func (r *PostgresRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	err = r.createRefreshTokenTx(ctx, tx, token)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// createRefreshTokenTx is a helper method that inserts a refresh token within an existing transaction
+func (r *PostgresRepository) createRefreshTokenTx(ctx context.Context, tx *sql.Tx, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	// Generate a new UUID if not provided
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := tx.ExecContext(ctx, query,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+
+	return err
+}
+
+func (r *PostgresRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT * FROM refresh_tokens WHERE token_hash = $1`
+
+	var token models.RefreshToken
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Token not found
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as used and stores its replacement in one transaction.
+// It returns false without storing anything if the old token was already used or revoked,
+// which lets the caller treat a lost race the same way as a replayed token.
+func (r *PostgresRepository) RotateRefreshToken(
+	ctx context.Context,
+	oldTokenID string,
+	newToken *models.RefreshToken,
+) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = $1
+		WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`,
+		time.Now().UTC(), oldTokenID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		err = tx.Rollback()
+		return false, err
+	}
+
+	err = r.createRefreshTokenTx(ctx, tx, newToken)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *PostgresRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), familyID)
+	return err
+}
+
+func (r *PostgresRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID)
+	return err
+}
+
+// Access token revocation repository methods
+func (r *PostgresRepository) RevokeAccessToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+
+	// Entries are only needed until the token would have expired anyway
+	_, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	_, err = r.db.ExecContext(ctx, query, jti, userID, expiresAt.UTC(), now)
+	return err
+}
+
+func (r *PostgresRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var revoked bool
+	err := r.db.GetContext(ctx, &revoked, query, jti)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// Single-use token repository methods
+func (r *PostgresRepository) CreateAuthToken(ctx context.Context, token *models.AuthToken) error {
+	query := `
+		INSERT INTO auth_tokens (id, user_id, purpose, token_hash, payload, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	// Generate a new UUID if not provided
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID, token.UserID, token.Purpose, token.TokenHash, token.Payload, token.ExpiresAt, token.CreatedAt)
+
+	return err
+}
+
+// GetAuthToken returns a token that is still usable without consuming it
+func (r *PostgresRepository) GetAuthToken(ctx context.Context, tokenHash, purpose string) (*models.AuthToken, error) {
+	query := `
+		SELECT * FROM auth_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+	`
+
+	var token models.AuthToken
+	err := r.db.GetContext(ctx, &token, query, tokenHash, purpose, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Token not found, expired or already used
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ConsumeAuthToken marks an unused, unexpired token as used and returns it.
+// It returns nil if no such token exists, so a token can only be consumed once.
+func (r *PostgresRepository) ConsumeAuthToken(ctx context.Context, tokenHash, purpose string) (*models.AuthToken, error) {
+	query := `
+		UPDATE auth_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING *
+	`
+
+	var token models.AuthToken
+	err := r.db.GetContext(ctx, &token, query, time.Now().UTC(), tokenHash, purpose)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Token not found, expired or already used
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// InvalidateAuthTokens marks every outstanding token of the user for the purpose as used
+func (r *PostgresRepository) InvalidateAuthTokens(ctx context.Context, userID, purpose string) error {
+	query := `UPDATE auth_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID, purpose)
+	return err
+}
+
+// Two-factor authentication repository methods
+func (r *PostgresRepository) GetUserMFA(ctx context.Context, userID string) (*models.UserMFA, error) {
+	query := `SELECT * FROM user_mfa WHERE user_id = $1`
+
+	var mfa models.UserMFA
+	err := r.db.GetContext(ctx, &mfa, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Not enrolled
+		}
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SaveTOTPSecret starts a new, unconfirmed enrolment, replacing any previous unconfirmed one
+func (r *PostgresRepository) SaveTOTPSecret(ctx context.Context, userID, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, created_at = EXCLUDED.created_at, last_used_step = 0
+		WHERE user_mfa.confirmed_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, secret, time.Now().UTC())
+	return err
+}
+
+// ConfirmTOTP enables two-factor login and replaces the user's recovery codes
+func (r *PostgresRepository) ConfirmTOTP(
+	ctx context.Context,
+	userID string,
+	step int64,
+	recoveryCodes []models.MFARecoveryCode,
+) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE user_mfa SET confirmed_at = $1, last_used_step = $2 WHERE user_id = $3`,
+		now, step, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		if code.ID == "" {
+			code.ID = uuid.New().String()
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`,
+			code.ID, userID, code.CodeHash, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records a TOTP step as used. It returns false if the step, or a later
+// one, was already used, so each code is accepted at most once.
+func (r *PostgresRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+
+	result, err := r.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r *PostgresRepository) ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r *PostgresRepository) DeleteUserMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Login throttling repository methods
+func (r *PostgresRepository) GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	query := `SELECT * FROM login_throttles WHERE throttle_key = $1`
+
+	var throttle models.LoginThrottle
+	err := r.db.GetContext(ctx, &throttle, query, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No recent failures
+		}
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+// RecordLoginFailure increments the failure counter and returns the new count.
+// The counter restarts at 1 if the previous failure, or the end of the last lockout,
+// is before windowStart, so sitting out a lockout doesn't reset the backoff.
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	query := `
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failures = CASE
+				WHEN GREATEST(login_throttles.last_failure_at, login_throttles.locked_until) < $3 THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`
+
+	var failures int
+	err := r.db.GetContext(ctx, &failures, query, key, time.Now().UTC(), windowStart.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (r *PostgresRepository) LockLoginThrottle(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = $1 WHERE throttle_key = $2`
+
+	_, err := r.db.ExecContext(ctx, query, until.UTC(), key)
+	return err
+}
+
+func (r *PostgresRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	query := `DELETE FROM login_throttles WHERE throttle_key = $1`
+
+	_, err := r.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// HitRateLimit counts a request against the key and returns the updated counter.
+// A window that started before windowStart is over, so a new one starts with this request.
+func (r *PostgresRepository) HitRateLimit(ctx context.Context, key string, windowStart time.Time) (*models.RateLimit, error) {
+	query := `
+		INSERT INTO rate_limits (limit_key, hits, window_start)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (limit_key) DO UPDATE
+		SET hits = CASE WHEN rate_limits.window_start < $3 THEN 1 ELSE rate_limits.hits + 1 END,
+			window_start = CASE WHEN rate_limits.window_start < $3 THEN EXCLUDED.window_start ELSE rate_limits.window_start END
+		RETURNING *
+	`
+
+	var limit models.RateLimit
+	err := r.db.GetContext(ctx, &limit, query, key, time.Now().UTC(), windowStart.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return &limit, nil
+}
+
+// Social login operations
+
+// CreateOIDCState stores a started social login, clearing out abandoned ones
+func (r *PostgresRepository) CreateOIDCState(ctx context.Context, state *models.OIDCState) error {
+	now := time.Now().UTC()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_states WHERE expires_at <= $1`, now); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_states (state_hash, provider, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	state.CreatedAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeOIDCState deletes and returns a pending login, so each state is only used once
+func (r *PostgresRepository) ConsumeOIDCState(ctx context.Context, stateHash, provider string) (*models.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > $3
+		RETURNING *
+	`
+
+	var state models.OIDCState
+	err := r.db.GetContext(ctx, &state, query, stateHash, provider, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Unknown, expired or already used
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (r *PostgresRepository) GetUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `SELECT * FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	var identity models.UserIdentity
+	err := r.db.GetContext(ctx, &identity, query, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Identity not linked
+		}
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (r *PostgresRepository) CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	identity.CreatedAt = time.Now().UTC()
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	return err
+}
+
+// CreateUserWithIdentity creates a user whose email was verified by the identity provider,
+// together with the linked identity
+func (r *PostgresRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	now := time.Now().UTC()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.EmailVerifiedAt = &now
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, email, name, password, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, user.ID, user.Email, user.Name, user.Password, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	identity.CreatedAt = now
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// Personal access token operations
+
+// CreatePersonalAccessToken stores the token together with the ledgers it is scoped to
+func (r *PostgresRepository) CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	token.CreatedAt = time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO personal_access_tokens (id, user_id, name, token_hash, permission, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, token.ID, token.UserID, token.Name, token.TokenHash, token.Permission, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, ledgerID := range token.LedgerIDs {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO personal_access_token_ledgers (token_id, ledger_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			token.ID, ledgerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// GetPersonalAccessTokenByHash returns the token with its ledgers, including revoked and expired tokens
+func (r *PostgresRepository) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	query := `SELECT * FROM personal_access_tokens WHERE token_hash = $1`
+
+	var token models.PersonalAccessToken
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Token not found
+		}
+		return nil, err
+	}
+
+	token.LedgerIDs, err = r.getPersonalAccessTokenLedgers(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ListPersonalAccessTokens returns the user's tokens that haven't been revoked, newest first
+func (r *PostgresRepository) ListPersonalAccessTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+	query := `
+		SELECT * FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	var tokens []models.PersonalAccessToken
+	err := r.db.SelectContext(ctx, &tokens, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tokens {
+		tokens[i].LedgerIDs, err = r.getPersonalAccessTokenLedgers(ctx, tokens[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tokens, nil
+}
+
+// RevokePersonalAccessToken returns false if the user has no such active token
+func (r *PostgresRepository) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) (bool, error) {
+	query := `
+		UPDATE personal_access_tokens SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// TouchPersonalAccessToken records when the token was last used
+func (r *PostgresRepository) TouchPersonalAccessToken(ctx context.Context, tokenID string) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), tokenID)
+	return err
+}
+
+func (r *PostgresRepository) getPersonalAccessTokenLedgers(ctx context.Context, tokenID string) ([]string, error) {
+	query := `SELECT ledger_id FROM personal_access_token_ledgers WHERE token_id = $1 ORDER BY ledger_id`
+
+	ledgerIDs := []string{}
+	err := r.db.SelectContext(ctx, &ledgerIDs, query, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ledgerIDs, nil
+}
+
+// Session operations
+func (r *PostgresRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device_name, platform, app_version, ip_address, user_agent, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+	}
+
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID, session.UserID, session.DeviceName, session.Platform, session.AppVersion,
+		session.IPAddress, session.UserAgent, session.CreatedAt, session.LastSeenAt)
+	return err
+}
+
+// TouchSession records activity on the session, keeping the last known IP address if none is given
+func (r *PostgresRepository) TouchSession(ctx context.Context, sessionID, ipAddress string) error {
+	query := `
+		UPDATE sessions SET last_seen_at = $1, ip_address = COALESCE(NULLIF($2, ''), ip_address)
+		WHERE id = $3
+	`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), ipAddress, sessionID)
+	return err
+}
+
+// ListActiveSessions returns sessions that haven't been revoked and were used since seenSince
+func (r *PostgresRepository) ListActiveSessions(ctx context.Context, userID string, seenSince time.Time) ([]models.Session, error) {
+	query := `
+		SELECT * FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+		ORDER BY last_seen_at DESC
+	`
+
+	var sessions []models.Session
+	err := r.db.SelectContext(ctx, &sessions, query, userID, seenSince)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession returns false if the user has no such active session
+func (r *PostgresRepository) RevokeSession(ctx context.Context, userID, sessionID string) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r *PostgresRepository) RevokeUserSessions(ctx context.Context, userID string) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID)
+	return err
+}
+
+// IsSessionRevoked reports whether the session was signed out. Unknown sessions are not revoked,
+// since tokens issued before session tracking have no row.
+func (r *PostgresRepository) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NOT NULL)`
+
+	var revoked bool
+	err := r.db.GetContext(ctx, &revoked, query, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeOtherSessions signs out every session of the user except keepSessionID, along with their refresh tokens
+func (r *PostgresRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL`,
+		now, userID, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND family_id <> $3 AND revoked_at IS NULL`,
+		now, userID, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// GetUserLedgerChanges returns every ledger change the user authored, oldest first
+func (r *PostgresRepository) GetUserLedgerChanges(ctx context.Context, userID string) ([]models.LedgerChange, error) {
+	query := `SELECT * FROM ledger_changes WHERE user_id = $1 ORDER BY timestamp, sequence_number`
+
+	var changes []models.LedgerChange
+	err := r.db.SelectContext(ctx, &changes, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (r *PostgresRepository) GetUserIdentities(ctx context.Context, userID string) ([]models.UserIdentity, error) {
+	query := `SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at`
+
+	var identities []models.UserIdentity
+	err := r.db.SelectContext(ctx, &identities, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Passkey operations
+
+// CreateWebAuthnChallenge stores a started passkey ceremony, clearing out abandoned ones
+func (r *PostgresRepository) CreateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	now := time.Now().UTC()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webauthn_challenges WHERE expires_at <= $1`, now); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webauthn_challenges (challenge_hash, ceremony, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	challenge.CreatedAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		challenge.ChallengeHash, challenge.Ceremony, challenge.UserID, challenge.ExpiresAt, challenge.CreatedAt)
+	return err
+}
+
+// ConsumeWebAuthnChallenge deletes and returns a pending ceremony, so each challenge is only used once
+func (r *PostgresRepository) ConsumeWebAuthnChallenge(
+	ctx context.Context,
+	challengeHash string,
+	ceremony string,
+) (*models.WebAuthnChallenge, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge_hash = $1 AND ceremony = $2 AND expires_at > $3
+		RETURNING *
+	`
+
+	var challenge models.WebAuthnChallenge
+	err := r.db.GetContext(ctx, &challenge, query, challengeHash, ceremony, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Unknown, expired or already used
+		}
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func (r *PostgresRepository) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	query := `
+		INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, sign_count, name, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	if credential.ID == "" {
+		credential.ID = uuid.New().String()
+	}
+
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		credential.ID, credential.UserID, credential.CredentialID, credential.PublicKey,
+		credential.SignCount, credential.Name, credential.CreatedAt)
+	return err
+}
+
+// GetWebAuthnCredential looks up a passkey by the credential ID the authenticator reports
+func (r *PostgresRepository) GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	query := `SELECT * FROM webauthn_credentials WHERE credential_id = $1`
+
+	var credential models.WebAuthnCredential
+	err := r.db.GetContext(ctx, &credential, query, credentialID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Not registered
+		}
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+func (r *PostgresRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]models.WebAuthnCredential, error) {
+	query := `SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+
+	credentials := []models.WebAuthnCredential{}
+	err := r.db.SelectContext(ctx, &credentials, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnSignCount records a login with the passkey. It returns false if the
+// signature counter didn't increase, which means the passkey may have been cloned or the
+// assertion replayed. Authenticators that don't count keep reporting 0, which is allowed.
+func (r *PostgresRepository) UpdateWebAuthnSignCount(ctx context.Context, id string, signCount int64) (bool, error) {
+	query := `
+		UPDATE webauthn_credentials SET sign_count = $1, last_used_at = $2
+		WHERE id = $3 AND (sign_count < $1 OR (sign_count = 0 AND $1 = 0))
+	`
+
+	result, err := r.db.ExecContext(ctx, query, signCount, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// DeleteWebAuthnCredential returns false if the user has no such passkey
+func (r *PostgresRepository) DeleteWebAuthnCredential(ctx context.Context, userID, id string) (bool, error) {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+type accessTokenContextKey struct{}
+
+// WithPersonalAccessToken marks the request as authenticated by a personal access token,
+// so ledger operations are limited to its scope
+func WithPersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenContextKey{}, token)
+}
+
+func personalAccessTokenFromContext(ctx context.Context) *models.PersonalAccessToken {
+	token, _ := ctx.Value(accessTokenContextKey{}).(*models.PersonalAccessToken)
+	return token
+}
+
+// checkLedgerAccess checks the user's own permission on the ledger and, for requests
+// made with a personal access token, the token's scope as well
+func (s *DefaultService) checkLedgerAccess(ctx context.Context, ledgerID, userID, requiredPermission string) (bool, error) {
+	if token := personalAccessTokenFromContext(ctx); token != nil {
+		if requiredPermission != "read" && token.Permission != "write" {
+			return false, nil
+		}
+
+		scoped := false
+		for _, id := range token.LedgerIDs {
+			if id == ledgerID {
+				scoped = true
+				break
+			}
+		}
+
+		if !scoped {
+			return false, nil
+		}
+	}
+
+	return s.repo.CheckLedgerAccess(ctx, ledgerID, userID, requiredPermission)
+}
+
+func (s *DefaultService) CreatePersonalAccessToken(
+	ctx context.Context,
+	userID string,
+	req models.CreatePersonalAccessTokenRequest,
+) (*models.CreatePersonalAccessTokenResponse, error) {
+	// A token can't be given more than the user currently has
+	for _, ledgerID := range req.LedgerIDs {
+		hasAccess, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, req.Permission)
+		if err != nil {
+			return nil, fmt.Errorf("error checking ledger access: %w", err)
+		}
+
+		if !hasAccess {
+			return nil, errors.New("you don't have the requested access to every ledger")
+		}
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error generating token: %w", err)
+	}
+	tokenString := PersonalAccessTokenPrefix + secret
+
+	token := &models.PersonalAccessToken{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Name:       req.Name,
+		TokenHash:  hashToken(tokenString),
+		Permission: req.Permission,
+		LedgerIDs:  req.LedgerIDs,
+	}
+
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreatePersonalAccessToken(ctx, token); err != nil {
+		return nil, fmt.Errorf("error creating token: %w", err)
+	}
+
+	return &models.CreatePersonalAccessTokenResponse{
+		Status:      "success",
+		Token:       tokenString,
+		AccessToken: *token,
+	}, nil
+}
+
+func (s *DefaultService) ListPersonalAccessTokens(ctx context.Context, userID string) (*models.ListPersonalAccessTokensResponse, error) {
+	tokens, err := s.repo.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tokens: %w", err)
+	}
+
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+
+	return &models.ListPersonalAccessTokensResponse{
+		Status: "success",
+		Tokens: tokens,
+	}, nil
+}
+
+func (s *DefaultService) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	revoked, err := s.repo.RevokePersonalAccessToken(ctx, userID, tokenID)
+	if err != nil {
+		return fmt.Errorf("error revoking token: %w", err)
+	}
+
+	if !revoked {
+		return errors.New("token not found")
+	}
+
+	return nil
+}
+
+// AuthenticatePersonalAccessToken returns the active token matching the presented value
+func (s *DefaultService) AuthenticatePersonalAccessToken(ctx context.Context, tokenString string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(tokenString, PersonalAccessTokenPrefix) {
+		return nil, errors.New("invalid personal access token")
+	}
+
+	token, err := s.repo.GetPersonalAccessTokenByHash(ctx, hashToken(tokenString))
+	if err != nil {
+		return nil, fmt.Errorf("error getting token: %w", err)
+	}
+
+	if token == nil || token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().UTC().After(*token.ExpiresAt)) {
+		return nil, errors.New("invalid personal access token")
+	}
+
+	// Last use is informational, so a failed update doesn't fail the request
+	if err := s.repo.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+		log.Printf("Warning: Failed to record use of personal access token %s: %v", token.ID, err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/mailer"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/repository"
+)
+
+// maxAccountDeletionAttempts bounds how often DeleteAccount plans the owned ledgers again
+// when they change while the account is being deleted
+const maxAccountDeletionAttempts = 3
+
+// ExportUserData collects the personal data stored about the user
+func (s *DefaultService) ExportUserData(ctx context.Context, userID string) (*models.UserDataExport, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	identities, err := s.repo.GetUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting identities: %w", err)
+	}
+
+	sessions, err := s.repo.ListActiveSessions(ctx, userID, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting sessions: %w", err)
+	}
+
+	passkeys, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting passkeys: %w", err)
+	}
+
+	memberships, err := s.repo.GetLedgerMemberships(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger memberships: %w", err)
+	}
+
+	changes, err := s.repo.GetUserLedgerChanges(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger changes: %w", err)
+	}
+
+	templates, err := s.repo.GetLedgerTemplates(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger templates: %w", err)
+	}
+
+	// Empty sections are exported as empty lists rather than null
+	export := &models.UserDataExport{
+		ExportedAt:  time.Now().UTC(),
+		User:        *user,
+		Identities:  append([]models.UserIdentity{}, identities...),
+		Sessions:    append([]models.Session{}, sessions...),
+		Passkeys:    passkeys,
+		Memberships: append([]models.LedgerMembership{}, memberships...),
+		Changes:     append([]models.LedgerChange{}, changes...),
+		Templates:   append([]models.LedgerTemplate{}, templates...),
+	}
+
+	return export, nil
+}
+
+// DeleteAccount deletes the user after checking their password. Owned ledgers are transferred
+// to the longest-standing member with write access, or deleted if the policy says so or no
+// such member exists. Changes the user made to other ledgers are kept without their author.
+func (s *DefaultService) DeleteAccount(ctx context.Context, userID string, req models.DeleteAccountRequest) error {
+	user, err := s.checkCurrentPassword(ctx, userID, req.CurrentPassword, req.ClientIP)
+	if err != nil {
+		return err
+	}
+
+	// The repository refuses a plan that went stale, e.g. because the user was handed another
+	// ledger in the meantime, so plan again until one goes through
+	var transfers map[string]string
+	var deleteLedgerIDs []string
+
+	for attempt := 1; ; attempt++ {
+		transfers, deleteLedgerIDs, err = s.planOwnedLedgers(ctx, user.ID, req.OwnedLedgers)
+		if err != nil {
+			return err
+		}
+
+		err = s.repo.DeleteUser(ctx, user.ID, transfers, deleteLedgerIDs)
+		if errors.Is(err, repository.ErrOwnedLedgersChanged) && attempt < maxAccountDeletionAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting user: %w", err)
+		}
+		break
+	}
+
+	// The account is already gone, so a failed notice is not worth failing the request over
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your account was deleted",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account and its personal data have been deleted. "+
+				"%d shared ledger(s) were handed to other members and %d ledger(s) were deleted.\n",
+			user.Name, len(transfers), len(deleteLedgerIDs)),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Warning: failed to send account deletion notice: %v", err)
+	}
+
+	return nil
+}
+
+// planOwnedLedgers decides what happens to each ledger the user owns: the returned transfers
+// map ledger IDs to their new owner, and the rest are to be deleted
+func (s *DefaultService) planOwnedLedgers(
+	ctx context.Context,
+	userID string,
+	policy string,
+) (map[string]string, []string, error) {
+	owned, err := s.repo.GetOwnedLedgers(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting owned ledgers: %w", err)
+	}
+
+	transfers := make(map[string]string)
+	var deleteLedgerIDs []string
+
+	for _, ledger := range owned {
+		newOwnerID := ""
+		if policy != "delete" {
+			newOwnerID, err = s.successorOwner(ctx, ledger.ID, userID)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if newOwnerID == "" {
+			deleteLedgerIDs = append(deleteLedgerIDs, ledger.ID)
+			continue
+		}
+		transfers[ledger.ID] = newOwnerID
+	}
+
+	return transfers, deleteLedgerIDs, nil
+}
+
+// successorOwner picks the member who takes over a ledger when its owner leaves.
+// It returns an empty ID if nobody else can write to the ledger.
+func (s *DefaultService) successorOwner(ctx context.Context, ledgerID, ownerID string) (string, error) {
+	members, err := s.repo.GetLedgerUsers(ctx, ledgerID)
+	if err != nil {
+		return "", fmt.Errorf("error getting ledger users: %w", err)
+	}
+
+	var successor *models.LedgerUser
+	for i, member := range members {
+		if member.UserID == ownerID || member.Permissions == "read" {
+			continue
+		}
+		if successor == nil || member.CreatedAt.Before(successor.CreatedAt) {
+			successor = &members[i]
+		}
+	}
+
+	if successor == nil {
+		return "", nil
+	}
+	return successor.UserID, nil
+}
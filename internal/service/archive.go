@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// ArchiveLedger makes the ledger read-only. Its members can still read and export it,
+// but no more changes can be submitted until it is unarchived.
+func (s *DefaultService) ArchiveLedger(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error) {
+	return s.setLedgerArchived(ctx, userID, ledgerID, true)
+}
+
+// UnarchiveLedger makes an archived ledger writable again
+func (s *DefaultService) UnarchiveLedger(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error) {
+	return s.setLedgerArchived(ctx, userID, ledgerID, false)
+}
+
+// setLedgerArchived archives or unarchives the ledger and records the event
+func (s *DefaultService) setLedgerArchived(
+	ctx context.Context,
+	userID string,
+	ledgerID string,
+	archive bool,
+) (*models.UpdateLedgerResponse, error) {
+	// Only the owner and admins can archive the ledger
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "admin")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !hasAccess {
+		return nil, errors.New("you don't have permission to archive this ledger")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if ledger == nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledgerID,
+		UserID:    &userID,
+		Type:      models.LedgerEventArchived,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	var changed bool
+	if archive {
+		changed, err = s.repo.ArchiveLedger(ctx, ledgerID, event)
+	} else {
+		event.Type = models.LedgerEventUnarchived
+		changed, err = s.repo.UnarchiveLedger(ctx, ledgerID, event)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error archiving ledger: %w", err)
+	}
+
+	if !changed && archive {
+		return nil, errors.New("ledger is already archived")
+	}
+
+	if !changed {
+		return nil, errors.New("ledger is not archived")
+	}
+
+	if archive {
+		ledger.ArchivedAt = &event.CreatedAt
+	} else {
+		ledger.ArchivedAt = nil
+	}
+
+	return &models.UpdateLedgerResponse{Status: "success", Ledger: *ledger}, nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/rongwang/COMP90018-server/internal/currency"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// ListCurrencies returns the currencies ledgers can be kept in
+func (s *DefaultService) ListCurrencies() models.CurrenciesResponse {
+	return models.CurrenciesResponse{
+		Status:     "success",
+		Currencies: currency.All(),
+	}
+}
+
+// normalizeCurrency returns the ISO 4217 code the user meant, so that "usd" is stored as "USD"
+func normalizeCurrency(code string) (string, error) {
+	c, ok := currency.Lookup(code)
+	if !ok {
+		return "", errors.New("unsupported currency")
+	}
+	return c.Code, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// maxLedgerNameLength is the length of the ledgers.name column, in characters
+const maxLedgerNameLength = 255
+
+// ForkLedger creates a new ledger owned by the user whose change log is a copy of the source's
+// up to req.AtSequence. The copied changes keep their authors and timestamps, and are numbered
+// from 1 in the new ledger.
+func (s *DefaultService) ForkLedger(
+	ctx context.Context,
+	userID string,
+	ledgerID string,
+	req models.ForkLedgerRequest,
+) (*models.LedgerResponse, error) {
+	// Personal access tokens are scoped to existing ledgers
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot create ledgers")
+	}
+
+	// Check if user has read permission
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "read")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !hasAccess {
+		return nil, errors.New("you don't have access to this ledger")
+	}
+
+	source, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if source == nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	atSequence := *req.AtSequence
+	latestSeq, err := s.repo.GetLatestSequenceNumber(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting latest sequence number: %w", err)
+	}
+
+	if atSequence > latestSeq {
+		return nil, errors.New("atSequence is past the ledger's latest sequence number")
+	}
+
+	// Changes up to atSequence never change, so they can be read before the fork is written
+	var changes []models.LedgerChange
+	if atSequence > 0 {
+		changes, err = s.repo.GetLedgerChangesBySequenceRange(ctx, ledgerID, 1, atSequence)
+		if err != nil {
+			return nil, fmt.Errorf("error getting ledger changes: %w", err)
+		}
+	}
+
+	name := req.Name
+	if name == "" {
+		name = forkedLedgerName(source.Name)
+	}
+
+	ledger := &models.Ledger{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: source.Description,
+		Currency:    source.Currency,
+		CreatedBy:   userID,
+	}
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledger.ID,
+		UserID:    &userID,
+		Type:      models.LedgerEventForked,
+		Details:   models.LedgerEventDetails{"sourceLedgerId": ledgerID, "atSequence": atSequence},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	forked := renumberLedgerChanges(changes)
+	if err := s.repo.ForkLedger(ctx, ledger, forked, event); err != nil {
+		return nil, fmt.Errorf("error forking ledger: %w", err)
+	}
+
+	return &models.LedgerResponse{
+		Status:                "success",
+		LedgerID:              ledger.ID,
+		Name:                  ledger.Name,
+		CreatedAt:             ledger.CreatedAt.Format(time.RFC3339),
+		InitialSequenceNumber: int64(len(forked)),
+	}, nil
+}
+
+// forkedLedgerName returns the source's name followed by "(fork)", shortening the source's
+// name if needed so the result still fits in the ledgers.name column
+func forkedLedgerName(name string) string {
+	const suffix = " (fork)"
+	if limit := maxLedgerNameLength - utf8.RuneCountInString(suffix); utf8.RuneCountInString(name) > limit {
+		name = string([]rune(name)[:limit])
+	}
+
+	return name + suffix
+}
+
+// renumberLedgerChanges copies changes, given in sequence order, numbering them from 1.
+// Each base sequence number is mapped to the number of copied changes at or before it,
+// so it still points at the same change.
+func renumberLedgerChanges(changes []models.LedgerChange) []models.LedgerChange {
+	renumbered := make([]models.LedgerChange, len(changes))
+	for i, change := range changes {
+		base := sort.Search(len(changes), func(j int) bool {
+			return changes[j].SequenceNumber > change.BaseSequenceNum
+		})
+
+		renumbered[i] = models.LedgerChange{
+			UserID:          change.UserID,
+			SequenceNumber:  int64(i + 1),
+			SQLStatement:    change.SQLStatement,
+			Timestamp:       change.Timestamp,
+			BaseSequenceNum: int64(base),
+		}
+	}
+
+	return renumbered
+}
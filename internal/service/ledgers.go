@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// defaultLedgerPageSize is the number of ledgers ListLedgers returns when no limit is given
+const defaultLedgerPageSize = 20
+
+// ledgerSortDescending lists the sorts ListLedgers accepts and whether each is descending
+// unless an order is given: most recently active or created first, names A to Z
+var ledgerSortDescending = map[string]bool{
+	"lastActivity": true,
+	"name":         false,
+	"createdAt":    true,
+}
+
+// ledgerCursor records where a page of ListLedgers ended. It is only valid with the
+// sort and order it was issued for.
+type ledgerCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         string `json:"id"`
+}
+
+// ListLedgers returns a page of the ledgers the user belongs to
+func (s *DefaultService) ListLedgers(
+	ctx context.Context,
+	userID string,
+	req models.ListLedgersRequest,
+) (*models.ListLedgersResponse, error) {
+	sort := req.Sort
+	if sort == "" {
+		sort = "lastActivity"
+	}
+
+	descending := ledgerSortDescending[sort]
+	if req.Order != "" {
+		descending = req.Order == "desc"
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultLedgerPageSize
+	}
+
+	// Archived ledgers are left out unless asked for
+	archived := req.Archived
+	if archived == "" {
+		archived = "exclude"
+	}
+
+	// One extra ledger tells whether there is another page
+	filter := models.LedgerListFilter{
+		Ownership:  req.Ownership,
+		Currency:   strings.ToUpper(req.Currency),
+		Archived:   archived,
+		Sort:       sort,
+		Descending: descending,
+		Limit:      limit + 1,
+	}
+
+	// A personal access token only sees the ledgers in its scope
+	if token := personalAccessTokenFromContext(ctx); token != nil {
+		filter.LedgerIDs = token.LedgerIDs
+	}
+
+	if req.Cursor != "" {
+		value, id, err := decodeLedgerCursor(req.Cursor, sort, descending)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		filter.AfterValue, filter.AfterID = value, id
+	}
+
+	ledgers, err := s.repo.GetUserLedgers(ctx, userID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error listing ledgers: %w", err)
+	}
+
+	res := &models.ListLedgersResponse{
+		Status:  "success",
+		Ledgers: []models.LedgerSummary{},
+	}
+
+	if len(ledgers) > limit {
+		ledgers = ledgers[:limit]
+		res.NextCursor = encodeLedgerCursor(sort, descending, ledgers[limit-1])
+	}
+
+	if len(ledgers) > 0 {
+		res.Ledgers = ledgers
+	}
+
+	return res, nil
+}
+
+// GetLedger returns the ledger with its owner, members and any pending ownership transfer
+func (s *DefaultService) GetLedger(ctx context.Context, userID, ledgerID string) (*models.LedgerDetailsResponse, error) {
+	// Check if user has read permission
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "read")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !hasAccess {
+		return nil, errors.New("you don't have access to this ledger")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if ledger == nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	members, err := s.repo.GetLedgerMembers(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger members: %w", err)
+	}
+
+	res := &models.LedgerDetailsResponse{
+		Status:  "success",
+		Ledger:  *ledger,
+		Members: []models.LedgerMember{},
+	}
+
+	for i, member := range members {
+		if member.Owner {
+			res.Owner = &members[i]
+		}
+	}
+
+	if len(members) > 0 {
+		res.Members = members
+	}
+
+	transfer, err := s.repo.GetLedgerTransfer(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger transfer: %w", err)
+	}
+
+	if transfer != nil && transfer.ExpiresAt.After(time.Now().UTC()) {
+		res.PendingTransfer = transfer
+	}
+
+	return res, nil
+}
+
+// UpdateLedger changes the ledger's name, description or currency. The request must carry the
+// ETag of the version it was based on, so that concurrent edits can't overwrite each other.
+func (s *DefaultService) UpdateLedger(
+	ctx context.Context,
+	userID string,
+	ledgerID string,
+	req models.UpdateLedgerRequest,
+) (*models.UpdateLedgerResponse, error) {
+	// Only the owner and admins can change the ledger itself
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "admin")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !hasAccess {
+		return nil, errors.New("you don't have permission to update this ledger")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if ledger == nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	if req.IfMatch == "" {
+		return nil, errors.New("the If-Match header is required")
+	}
+
+	if req.Currency != nil {
+		currency, err := normalizeCurrency(*req.Currency)
+		if err != nil {
+			return nil, err
+		}
+		req.Currency = &currency
+	}
+
+	expectedUpdatedAt := ledger.UpdatedAt
+	if strings.TrimPrefix(req.IfMatch, "W/") != ledger.ETag() {
+		return nil, errors.New("ledger has been modified")
+	}
+
+	// Record each field that actually changes
+	changes := models.LedgerEventDetails{}
+	update := func(field string, current *string, value *string) {
+		if value == nil || *value == *current {
+			return
+		}
+		changes[field] = map[string]string{"from": *current, "to": *value}
+		*current = *value
+	}
+
+	update("name", &ledger.Name, req.Name)
+	update("description", &ledger.Description, req.Description)
+	update("currency", &ledger.Currency, req.Currency)
+
+	if len(changes) == 0 {
+		return &models.UpdateLedgerResponse{Status: "success", Ledger: *ledger}, nil
+	}
+
+	// Postgres keeps microseconds, so the ETag returned here matches the stored value
+	ledger.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledgerID,
+		UserID:    &userID,
+		Type:      models.LedgerEventMetadataUpdated,
+		Details:   changes,
+		CreatedAt: ledger.UpdatedAt,
+	}
+
+	updated, err := s.repo.UpdateLedger(ctx, ledger, expectedUpdatedAt, event)
+	if err != nil {
+		return nil, fmt.Errorf("error updating ledger: %w", err)
+	}
+
+	if !updated {
+		return nil, errors.New("ledger has been modified")
+	}
+
+	return &models.UpdateLedgerResponse{Status: "success", Ledger: *ledger}, nil
+}
+
+// GetLedgerEvents returns the events recorded on the ledger after since
+func (s *DefaultService) GetLedgerEvents(
+	ctx context.Context,
+	userID string,
+	ledgerID string,
+	since time.Time,
+) (*models.LedgerEventsResponse, error) {
+	// Check if user has read permission
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "read")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !hasAccess {
+		return nil, errors.New("you don't have access to this ledger")
+	}
+
+	events, err := s.repo.GetLedgerEvents(ctx, ledgerID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger events: %w", err)
+	}
+
+	if events == nil {
+		events = []models.LedgerEvent{}
+	}
+
+	return &models.LedgerEventsResponse{
+		Status:   "success",
+		LedgerID: ledgerID,
+		Events:   events,
+	}, nil
+}
+
+// encodeLedgerCursor returns the cursor for the page after the given ledger
+func encodeLedgerCursor(sort string, descending bool, ledger models.LedgerSummary) string {
+	cursor := ledgerCursor{Sort: sort, Descending: descending, ID: ledger.ID}
+	switch sort {
+	case "name":
+		cursor.Value = ledger.Name
+	case "createdAt":
+		cursor.Value = ledger.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = ledger.LastActivityAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeLedgerCursor returns the sort value and ledger ID a cursor points after
+func decodeLedgerCursor(encoded, sort string, descending bool) (interface{}, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cursor ledgerCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, "", err
+	}
+
+	if cursor.Sort != sort || cursor.Descending != descending || cursor.ID == "" {
+		return nil, "", errors.New("cursor was issued for a different sort")
+	}
+
+	if sort == "name" {
+		return cursor.Value, cursor.ID, nil
+	}
+
+	value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return value, cursor.ID, nil
+}
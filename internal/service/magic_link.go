@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rongwang/COMP90018-server/internal/mailer"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// RequestMagicLink emails a single-use sign-in link if an account exists for the address.
+// Requests are rate limited per address whether or not the account exists, so neither
+// the response nor the limit can be used to discover accounts.
+func (s *DefaultService) RequestMagicLink(ctx context.Context, req models.MagicLinkRequest) error {
+	if err := s.checkRateLimit(ctx, magicLinkRateLimitKey(req.Email), s.magicLinkMaxRequests, s.magicLinkWindow); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	// Only the most recently requested link stays valid
+	if err := s.repo.InvalidateAuthTokens(ctx, user.ID, models.TokenPurposeMagicLink); err != nil {
+		return fmt.Errorf("error invalidating sign-in links: %w", err)
+	}
+
+	token, err := s.createAuthToken(ctx, user.ID, models.TokenPurposeMagicLink, user.Email, s.magicLinkDuration)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to sign in:\n\n%s/magic-link?token=%s\n\n"+
+				"The link expires in %s and can only be used once. If you didn't ask to sign in, "+
+				"you can ignore this email.\n",
+			user.Name, s.publicURL, token, formatDuration(s.magicLinkDuration)),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending sign-in email: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink signs the user in with a link from RequestMagicLink. The link stands in
+// for the password, so accounts with two-factor authentication still get a challenge.
+func (s *DefaultService) ConsumeMagicLink(ctx context.Context, req models.ConsumeMagicLinkRequest) (*models.AuthResponse, error) {
+	token, err := s.repo.ConsumeAuthToken(ctx, hashToken(req.Token), models.TokenPurposeMagicLink)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming sign-in link: %w", err)
+	}
+
+	if token == nil {
+		return nil, errors.New("invalid or expired sign-in link")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	// A link sent before an email change doesn't sign in to the new address
+	if user == nil || user.Email != token.Payload {
+		return nil, errors.New("invalid or expired sign-in link")
+	}
+
+	// Opening the link proves the user controls the address
+	if user.EmailVerifiedAt == nil {
+		if _, err := s.repo.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+			return nil, fmt.Errorf("error marking email verified: %w", err)
+		}
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return s.mfaChallenge(user)
+	}
+
+	if err := s.clearLoginFailures(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user, req.DeviceInfo)
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/totp"
+)
+
+// Token types carried in the "typ" claim. Only access tokens are accepted by AuthMiddleware.
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa"
+)
+
+const (
+	mfaChallengeDuration = 5 * time.Minute
+	recoveryCodeCount    = 10
+)
+
+// LoginMFA completes a login that was answered with an "mfa_required" challenge
+func (s *DefaultService) LoginMFA(ctx context.Context, req models.MFALoginRequest) (*models.AuthResponse, error) {
+	userID, err := s.parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	// Two-factor authentication was disabled after the challenge was issued
+	if mfa == nil || mfa.ConfirmedAt == nil {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if err := s.checkLoginThrottle(ctx, user.Email, req.ClientIP); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(ctx, mfa, req.Code, req.RecoveryCode); err != nil {
+		if err.Error() == "invalid two-factor code" {
+			if err := s.recordLoginFailure(ctx, user.Email, req.ClientIP); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.clearLoginFailures(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user, req.DeviceInfo)
+}
+
+// EnrollTOTP generates a new TOTP secret. It has no effect on login until confirmed.
+func (s *DefaultService) EnrollTOTP(ctx context.Context, userID string) (*models.TOTPEnrollmentResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error generating secret: %w", err)
+	}
+
+	if err := s.repo.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		return nil, fmt.Errorf("error saving secret: %w", err)
+	}
+
+	return &models.TOTPEnrollmentResponse{
+		Status:     "success",
+		Secret:     secret,
+		OTPAuthURI: totp.URI(s.mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor login once the user proves their app produces valid codes
+func (s *DefaultService) ConfirmTOTP(
+	ctx context.Context,
+	userID string,
+	req models.ConfirmTOTPRequest,
+) (*models.RecoveryCodesResponse, error) {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa == nil {
+		return nil, errors.New("two-factor enrolment not started")
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	step, ok := totp.Validate(mfa.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid two-factor code")
+	}
+
+	codes, records, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error generating recovery codes: %w", err)
+	}
+
+	if err := s.repo.ConfirmTOTP(ctx, userID, step, records); err != nil {
+		return nil, fmt.Errorf("error confirming two-factor authentication: %w", err)
+	}
+
+	return &models.RecoveryCodesResponse{
+		Status:        "success",
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// DisableTOTP turns two-factor login off. It needs both the password and a second factor.
+func (s *DefaultService) DisableTOTP(ctx context.Context, userID string, req models.DisableTOTPRequest) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	ok, err := s.checkPassword(ctx, user, req.Password)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("invalid password")
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa == nil || mfa.ConfirmedAt == nil {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if err := s.verifySecondFactor(ctx, mfa, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteUserMFA(ctx, userID); err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+
+	return nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func (s *DefaultService) verifySecondFactor(ctx context.Context, mfa *models.UserMFA, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := totp.Validate(mfa.TOTPSecret, code, time.Now())
+		if !ok {
+			return errors.New("invalid two-factor code")
+		}
+
+		// Each code is only accepted once, even within its validity window
+		fresh, err := s.repo.UseTOTPStep(ctx, mfa.UserID, step)
+		if err != nil {
+			return fmt.Errorf("error recording two-factor code: %w", err)
+		}
+
+		if !fresh {
+			return errors.New("invalid two-factor code")
+		}
+
+		return nil
+	}
+
+	consumed, err := s.repo.ConsumeRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return fmt.Errorf("error consuming recovery code: %w", err)
+	}
+
+	if !consumed {
+		return errors.New("invalid two-factor code")
+	}
+
+	return nil
+}
+
+// mfaChallenge returns the response for a correct password on an account with two-factor authentication
+func (s *DefaultService) mfaChallenge(user *models.User) (*models.AuthResponse, error) {
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": time.Now().Add(mfaChallengeDuration).Unix(),
+		"iat": time.Now().Unix(),
+		"typ": tokenTypeMFAChallenge,
+		"jti": uuid.New().String(),
+	}
+
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("error generating mfa token: %w", err)
+	}
+
+	return &models.AuthResponse{
+		Status:      "mfa_required",
+		UserID:      user.ID,
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(mfaChallengeDuration.Seconds()),
+	}, nil
+}
+
+// parseMFAChallenge validates a challenge token and returns the user it was issued to
+func (s *DefaultService) parseMFAChallenge(tokenString string) (string, error) {
+	claims, err := s.keys.Parse(tokenString)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+
+	if typ, _ := claims["typ"].(string); typ != tokenTypeMFAChallenge {
+		return "", errors.New("invalid token type")
+	}
+
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return "", errors.New("invalid user ID in token")
+	}
+
+	return userID, nil
+}
+
+// generateRecoveryCodes returns codes to show to the user once, and the hashed records to store
+func generateRecoveryCodes(userID string) ([]string, []models.MFARecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		// 40 bits as 8 base32 characters, shown as XXXX-XXXX
+		raw := base32.StdEncoding.EncodeToString(b)
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+		records = append(records, models.MFARecoveryCode{
+			ID:       uuid.New().String(),
+			UserID:   userID,
+			CodeHash: hashToken(raw),
+		})
+	}
+
+	return codes, records, nil
+}
+
+// normalizeRecoveryCode accepts codes typed in lower case or without the separator
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/oidc"
+)
+
+// StartOIDCLogin begins an authorization code flow with PKCE at the identity provider
+func (s *DefaultService) StartOIDCLogin(ctx context.Context, providerName string) (*models.OIDCStartResponse, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, errors.New("unknown identity provider")
+	}
+
+	state, err := oidc.GenerateRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error generating state: %w", err)
+	}
+
+	nonce, err := oidc.GenerateRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	codeVerifier, err := oidc.GenerateRandom()
+	if err != nil {
+		return nil, fmt.Errorf("error generating code verifier: %w", err)
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("error contacting identity provider: %w", err)
+	}
+
+	// Only the hash of the state is stored; the verifier and nonce never leave the server
+	err = s.repo.CreateOIDCState(ctx, &models.OIDCState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().UTC().Add(s.oidcStateDuration),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error storing login state: %w", err)
+	}
+
+	return &models.OIDCStartResponse{
+		Status:           "success",
+		AuthorizationURL: authorizationURL,
+		State:            state,
+	}, nil
+}
+
+// CompleteOIDCLogin exchanges the authorization code, validates the ID token and signs the user in
+func (s *DefaultService) CompleteOIDCLogin(ctx context.Context, providerName string, req models.OIDCCallbackRequest) (*models.AuthResponse, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, errors.New("unknown identity provider")
+	}
+
+	state, err := s.repo.ConsumeOIDCState(ctx, hashToken(req.State), providerName)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming login state: %w", err)
+	}
+
+	if state == nil {
+		return nil, errors.New("invalid or expired login state")
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, req.Code, state.CodeVerifier)
+	if err != nil {
+		log.Printf("Warning: OIDC code exchange with %s failed: %v", providerName, err)
+		return nil, errors.New("identity provider rejected the login")
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, state.Nonce)
+	if err != nil {
+		log.Printf("Warning: OIDC ID token from %s rejected: %v", providerName, err)
+		return nil, errors.New("identity provider rejected the login")
+	}
+
+	user, err := s.resolveOIDCUser(ctx, providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Social logins still have to pass the user's own second factor
+	mfa, err := s.repo.GetUserMFA(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return s.mfaChallenge(user)
+	}
+
+	return s.startSession(ctx, user, req.DeviceInfo)
+}
+
+// resolveOIDCUser finds the user linked to the provider account. Unlinked accounts are linked
+// to the user with the same verified email, or get a new user.
+func (s *DefaultService) resolveOIDCUser(ctx context.Context, providerName string, claims *oidc.Claims) (*models.User, error) {
+	identity, err := s.repo.GetUserIdentity(ctx, providerName, claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("error getting identity: %w", err)
+	}
+
+	if identity != nil {
+		user, err := s.repo.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting user: %w", err)
+		}
+
+		if user == nil {
+			return nil, errors.New("user not found")
+		}
+		return user, nil
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.New("identity provider did not return a verified email")
+	}
+
+	identity = &models.UserIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	existing, err := s.repo.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if existing != nil {
+		// Linking to an unverified account would hand it to whoever registered the address first
+		if existing.EmailVerifiedAt == nil {
+			return nil, errors.New("an account with this email exists but is not verified")
+		}
+
+		identity.UserID = existing.ID
+		if err := s.repo.CreateUserIdentity(ctx, identity); err != nil {
+			return nil, fmt.Errorf("error linking identity: %w", err)
+		}
+		return existing, nil
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	// An empty password hash never matches, so the account can only use social login
+	// until the user sets a password through the reset flow
+	user := &models.User{
+		ID:    uuid.New().String(),
+		Email: claims.Email,
+		Name:  name,
+	}
+
+	if err := s.repo.CreateUserWithIdentity(ctx, user, identity); err != nil {
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+
+	return user, nil
+}
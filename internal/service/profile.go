@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rongwang/COMP90018-server/internal/mailer"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// GetProfile returns the signed-in user's account details
+func (s *DefaultService) GetProfile(ctx context.Context, userID string) (*models.UserResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	return &models.UserResponse{
+		Status: "success",
+		User:   *user,
+	}, nil
+}
+
+// UpdateProfile changes the fields present in the request
+func (s *DefaultService) UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (*models.UserResponse, error) {
+	if req.Name != nil {
+		if err := s.repo.UpdateUserName(ctx, userID, *req.Name); err != nil {
+			return nil, fmt.Errorf("error updating name: %w", err)
+		}
+	}
+
+	return s.GetProfile(ctx, userID)
+}
+
+// ChangePassword sets a new password and signs out every other session
+func (s *DefaultService) ChangePassword(ctx context.Context, userID, sessionID string, req models.ChangePasswordRequest) error {
+	user, err := s.checkCurrentPassword(ctx, userID, req.CurrentPassword, req.ClientIP)
+	if err != nil {
+		return err
+	}
+
+	if err := s.passwords.CheckPolicy(req.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	if err := s.repo.UpdateUserPassword(ctx, user.ID, hashedPassword); err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	// Reset links sent for the old password must not override the new one
+	if err := s.repo.InvalidateAuthTokens(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+		return fmt.Errorf("error invalidating reset tokens: %w", err)
+	}
+
+	if err := s.repo.RevokeOtherSessions(ctx, user.ID, sessionID); err != nil {
+		return fmt.Errorf("error revoking other sessions: %w", err)
+	}
+
+	return nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address.
+// The account keeps its current address until the link is used.
+func (s *DefaultService) RequestEmailChange(ctx context.Context, userID string, req models.ChangeEmailRequest) error {
+	user, err := s.checkCurrentPassword(ctx, userID, req.CurrentPassword, req.ClientIP)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetUserByEmail(ctx, req.NewEmail)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if existing != nil {
+		return errors.New("email already in use")
+	}
+
+	// Only the most recently requested change stays valid
+	if err := s.repo.InvalidateAuthTokens(ctx, user.ID, models.TokenPurposeEmailChange); err != nil {
+		return fmt.Errorf("error invalidating email change tokens: %w", err)
+	}
+
+	token, err := s.createAuthToken(ctx, user.ID, models.TokenPurposeEmailChange, req.NewEmail, s.verificationDuration)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      req.NewEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to use this address for your account:\n\n%s/confirm-email?token=%s\n\n"+
+				"The link expires in %s. Until then you keep signing in with %s.\n",
+			user.Name, s.publicURL, token, formatDuration(s.verificationDuration), user.Email),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending confirmation email: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the account to the address the confirmation link was sent to
+func (s *DefaultService) ConfirmEmailChange(ctx context.Context, req models.ConfirmEmailChangeRequest) error {
+	token, err := s.repo.ConsumeAuthToken(ctx, hashToken(req.Token), models.TokenPurposeEmailChange)
+	if err != nil {
+		return fmt.Errorf("error consuming email change token: %w", err)
+	}
+
+	if token == nil {
+		return errors.New("invalid or expired email change token")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return errors.New("invalid or expired email change token")
+	}
+
+	// Someone may have registered the address since the change was requested
+	existing, err := s.repo.GetUserByEmail(ctx, token.Payload)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if existing != nil {
+		return errors.New("email already in use")
+	}
+
+	if err := s.repo.ChangeUserEmail(ctx, user.ID, token.Payload); err != nil {
+		return fmt.Errorf("error changing email: %w", err)
+	}
+
+	// Let the old address know, in case the change wasn't made by its owner
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account now uses %s instead of this address. If you didn't make this change, "+
+				"please contact support.\n",
+			user.Name, token.Payload),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending email change notice: %w", err)
+	}
+
+	return nil
+}
+
+// checkCurrentPassword re-authenticates the user before a sensitive change.
+// Wrong guesses count towards the same lockout as failed logins.
+func (s *DefaultService) checkCurrentPassword(ctx context.Context, userID, password, clientIP string) (*models.User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	if err := s.checkLoginThrottle(ctx, user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.checkPassword(ctx, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if err := s.recordLoginFailure(ctx, user.Email, clientIP); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("current password is incorrect")
+	}
+
+	return user, nil
+}
@@ -2,15 +2,26 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/config"
+	"github.com/rongwang/COMP90018-server/internal/keyset"
+	"github.com/rongwang/COMP90018-server/internal/mailer"
 	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/oidc"
+	"github.com/rongwang/COMP90018-server/internal/password"
 	"github.com/rongwang/COMP90018-server/internal/repository"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/rongwang/COMP90018-server/internal/webauthn"
 )
 
 // Service defines all the business logic operations
@@ -18,10 +29,79 @@ type Service interface {
 	// Authentication
 	SignUp(ctx context.Context, req models.SignUpRequest) (*models.AuthResponse, error)
 	Login(ctx context.Context, req models.LoginRequest) (*models.AuthResponse, error)
+	RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (*models.AuthResponse, error)
+	ParseToken(tokenString string) (jwt.MapClaims, error)
+	ValidateAccessToken(ctx context.Context, userID, tokenID, sessionID string, tokenVersion int) error
+	JWKS() models.JWKSResponse
+	ListCurrencies() models.CurrenciesResponse
+	Logout(ctx context.Context, userID, tokenID, sessionID string, expiresAt time.Time) error
+	LogoutAll(ctx context.Context, userID string) error
+	ForgotPassword(ctx context.Context, req models.ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error
+	VerifyEmail(ctx context.Context, req models.VerifyEmailRequest) error
+	ResendVerification(ctx context.Context, req models.ResendVerificationRequest) error
+	RequestMagicLink(ctx context.Context, req models.MagicLinkRequest) error
+	ConsumeMagicLink(ctx context.Context, req models.ConsumeMagicLinkRequest) (*models.AuthResponse, error)
+
+	// Two-factor authentication
+	LoginMFA(ctx context.Context, req models.MFALoginRequest) (*models.AuthResponse, error)
+	EnrollTOTP(ctx context.Context, userID string) (*models.TOTPEnrollmentResponse, error)
+	ConfirmTOTP(ctx context.Context, userID string, req models.ConfirmTOTPRequest) (*models.RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID string, req models.DisableTOTPRequest) error
+
+	// Social login
+	StartOIDCLogin(ctx context.Context, provider string) (*models.OIDCStartResponse, error)
+	CompleteOIDCLogin(ctx context.Context, provider string, req models.OIDCCallbackRequest) (*models.AuthResponse, error)
+
+	// Passkeys
+	StartWebAuthnRegistration(ctx context.Context, userID string) (*models.WebAuthnRegistrationStartResponse, error)
+	FinishWebAuthnRegistration(ctx context.Context, userID string, req models.FinishWebAuthnRegistrationRequest) (*models.WebAuthnCredentialResponse, error)
+	StartWebAuthnLogin(ctx context.Context) (*models.WebAuthnLoginStartResponse, error)
+	FinishWebAuthnLogin(ctx context.Context, req models.FinishWebAuthnLoginRequest) (*models.AuthResponse, error)
+	ListWebAuthnCredentials(ctx context.Context, userID string) (*models.WebAuthnCredentialsResponse, error)
+	DeleteWebAuthnCredential(ctx context.Context, userID, credentialID string) error
+
+	// Personal access tokens
+	CreatePersonalAccessToken(ctx context.Context, userID string, req models.CreatePersonalAccessTokenRequest) (*models.CreatePersonalAccessTokenResponse, error)
+	ListPersonalAccessTokens(ctx context.Context, userID string) (*models.ListPersonalAccessTokensResponse, error)
+	RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) error
+	AuthenticatePersonalAccessToken(ctx context.Context, tokenString string) (*models.PersonalAccessToken, error)
+
+	// Profile
+	GetProfile(ctx context.Context, userID string) (*models.UserResponse, error)
+	UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (*models.UserResponse, error)
+	ChangePassword(ctx context.Context, userID, sessionID string, req models.ChangePasswordRequest) error
+	RequestEmailChange(ctx context.Context, userID string, req models.ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, req models.ConfirmEmailChangeRequest) error
+	ExportUserData(ctx context.Context, userID string) (*models.UserDataExport, error)
+	DeleteAccount(ctx context.Context, userID string, req models.DeleteAccountRequest) error
+
+	// Sessions
+	ListSessions(ctx context.Context, userID, currentSessionID string) (*models.SessionsResponse, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
 
 	// Ledger operations
 	CreateLedger(ctx context.Context, userID string, req models.CreateLedgerRequest) (*models.LedgerResponse, error)
-	DeleteLedger(ctx context.Context, userID, ledgerID string) error
+	DeleteLedger(ctx context.Context, userID, ledgerID string) (*models.DeleteLedgerResponse, error)
+	ListLedgers(ctx context.Context, userID string, req models.ListLedgersRequest) (*models.ListLedgersResponse, error)
+	GetLedger(ctx context.Context, userID, ledgerID string) (*models.LedgerDetailsResponse, error)
+	UpdateLedger(ctx context.Context, userID, ledgerID string, req models.UpdateLedgerRequest) (*models.UpdateLedgerResponse, error)
+	GetLedgerEvents(ctx context.Context, userID, ledgerID string, since time.Time) (*models.LedgerEventsResponse, error)
+	ForkLedger(ctx context.Context, userID, ledgerID string, req models.ForkLedgerRequest) (*models.LedgerResponse, error)
+
+	// Ledger trash
+	ListTrashedLedgers(ctx context.Context, userID string) (*models.TrashedLedgersResponse, error)
+	RestoreLedger(ctx context.Context, userID, ledgerID string) (*models.RestoreLedgerResponse, error)
+	PurgeTrashedLedgers(ctx context.Context) (int64, error)
+
+	// Ledger templates
+	ListLedgerTemplates(ctx context.Context, userID string) (*models.LedgerTemplatesResponse, error)
+	SaveLedgerTemplate(ctx context.Context, userID string, req models.SaveLedgerTemplateRequest) (*models.LedgerTemplateResponse, error)
+	DeleteLedgerTemplate(ctx context.Context, userID, templateID string) error
+
+	// Ledger archiving
+	ArchiveLedger(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error)
+	UnarchiveLedger(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error)
 
 	// Ledger changes
 	SubmitLedgerChange(ctx context.Context, userID, ledgerID string, req models.LedgerChangeRequest) (*models.LedgerChangeResponse, error)
@@ -30,21 +110,77 @@ type Service interface {
 
 	// Ledger sharing
 	AddUserToLedger(ctx context.Context, userID, ledgerID string, req models.AddUserToLedgerRequest) (*models.AddUserResponse, error)
+
+	// Ledger ownership transfer
+	ProposeLedgerTransfer(ctx context.Context, userID, ledgerID string, req models.TransferLedgerRequest) (*models.LedgerTransferResponse, error)
+	AcceptLedgerTransfer(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error)
+	CancelLedgerTransfer(ctx context.Context, userID, ledgerID string) error
 }
 
 // DefaultService implements the Service interface
 type DefaultService struct {
-	repo          repository.Repository
-	jwtSecret     []byte
-	tokenDuration time.Duration
+	repo                   repository.Repository
+	mailer                 mailer.Mailer
+	publicURL              string
+	keys                   *keyset.KeySet
+	passwords              *password.Manager
+	tokenDuration          time.Duration
+	refreshTokenDuration   time.Duration
+	passwordResetDuration  time.Duration
+	verificationDuration   time.Duration
+	magicLinkDuration      time.Duration
+	magicLinkMaxRequests   int
+	magicLinkWindow        time.Duration
+	requireVerifiedLogin   bool
+	requireVerifiedSharing bool
+	mfaIssuer              string
+	throttle               config.ThrottleConfig
+	oidcProviders          map[string]*oidc.Provider
+	oidcStateDuration      time.Duration
+	webauthn               *webauthn.RelyingParty
+	webauthnTimeout        time.Duration
+	trashRetention         time.Duration
+	transferTTL            time.Duration
 }
 
 // NewDefaultService creates a new DefaultService
-func NewDefaultService(repo repository.Repository, jwtSecret string) Service {
+func NewDefaultService(
+	repo repository.Repository,
+	cfg *config.Config,
+	m mailer.Mailer,
+	keys *keyset.KeySet,
+	passwords *password.Manager,
+) Service {
+	// Providers fetch their discovery documents lazily, so a provider outage doesn't stop startup
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	oidcProviders := make(map[string]*oidc.Provider)
+	for name, providerCfg := range cfg.OIDC.Providers {
+		oidcProviders[name] = oidc.NewProvider(name, providerCfg, httpClient)
+	}
+
 	return &DefaultService{
-		repo:          repo,
-		jwtSecret:     []byte(jwtSecret),
-		tokenDuration: 24 * time.Hour, // 24 hours token validity
+		repo:                   repo,
+		mailer:                 m,
+		publicURL:              cfg.Server.PublicURL,
+		keys:                   keys,
+		passwords:              passwords,
+		tokenDuration:          cfg.Auth.AccessTokenTTL,
+		refreshTokenDuration:   cfg.Auth.RefreshTokenTTL,
+		passwordResetDuration:  cfg.Auth.PasswordResetTTL,
+		verificationDuration:   cfg.Auth.EmailVerificationTTL,
+		magicLinkDuration:      cfg.Auth.MagicLinkTTL,
+		magicLinkMaxRequests:   cfg.Auth.MagicLinkMaxRequests,
+		magicLinkWindow:        cfg.Auth.MagicLinkWindow,
+		requireVerifiedLogin:   cfg.Auth.RequireVerifiedLogin,
+		requireVerifiedSharing: cfg.Auth.RequireVerifiedSharing,
+		mfaIssuer:              cfg.Auth.MFAIssuer,
+		throttle:               cfg.Auth.Throttle,
+		oidcProviders:          oidcProviders,
+		oidcStateDuration:      cfg.OIDC.StateTTL,
+		webauthn:               webauthn.NewRelyingParty(cfg.WebAuthn),
+		webauthnTimeout:        cfg.WebAuthn.ChallengeTTL,
+		trashRetention:         cfg.Ledger.TrashRetention,
+		transferTTL:            cfg.Ledger.TransferTTL,
 	}
 }
 
@@ -60,8 +196,12 @@ func (s *DefaultService) SignUp(ctx context.Context, req models.SignUpRequest) (
 		return nil, errors.New("user with this email already exists")
 	}
 
+	if err := s.passwords.CheckPolicy(req.Password, req.Email, req.Name); err != nil {
+		return nil, err
+	}
+
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
@@ -71,13 +211,19 @@ func (s *DefaultService) SignUp(ctx context.Context, req models.SignUpRequest) (
 		ID:       uuid.New().String(),
 		Email:    req.Email,
 		Name:     req.Name,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
 
 	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return nil, fmt.Errorf("error creating user: %w", err)
 	}
 
+	// The account exists at this point, so a delivery failure must not fail the signup;
+	// the user can ask for another verification email
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Warning: Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	return &models.AuthResponse{
 		Status: "success",
 		UserID: user.ID,
@@ -87,6 +233,11 @@ func (s *DefaultService) SignUp(ctx context.Context, req models.SignUpRequest) (
 }
 
 func (s *DefaultService) Login(ctx context.Context, req models.LoginRequest) (*models.AuthResponse, error) {
+	// Locked accounts and addresses are rejected before the password is checked
+	if err := s.checkLoginThrottle(ctx, req.Email, req.ClientIP); err != nil {
+		return nil, err
+	}
+
 	// Get the user
 	user, err := s.repo.GetUserByEmail(ctx, req.Email)
 	if err != nil {
@@ -94,26 +245,323 @@ func (s *DefaultService) Login(ctx context.Context, req models.LoginRequest) (*m
 	}
 
 	if user == nil {
+		if err := s.recordLoginFailure(ctx, req.Email, req.ClientIP); err != nil {
+			return nil, err
+		}
 		return nil, errors.New("invalid email or password")
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	ok, err := s.checkPassword(ctx, user, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		if err := s.recordLoginFailure(ctx, req.Email, req.ClientIP); err != nil {
+			return nil, err
+		}
 		return nil, errors.New("invalid email or password")
 	}
 
-	// Generate JWT token
-	token, err := s.generateJWT(user)
+	if s.requireVerifiedLogin && user.EmailVerifiedAt == nil {
+		return nil, errors.New("email address not verified")
+	}
+
+	// With two-factor authentication enabled the password only earns a challenge
+	mfa, err := s.repo.GetUserMFA(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return s.mfaChallenge(user)
+	}
+
+	if err := s.clearLoginFailures(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	// Every login starts a new session with its own refresh token family
+	return s.startSession(ctx, user, req.DeviceInfo)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated refresh token
+func (s *DefaultService) RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (*models.AuthResponse, error) {
+	stored, err := s.repo.GetRefreshTokenByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("error getting refresh token: %w", err)
+	}
+
+	if stored == nil || stored.RevokedAt != nil || time.Now().UTC().After(stored.ExpiresAt) {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// A refresh token that was already used means it has leaked, so the whole family is revoked
+	if stored.UsedAt != nil {
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			return nil, fmt.Errorf("error revoking refresh token family: %w", err)
+		}
+		return nil, errors.New("refresh token reuse detected")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	refreshToken, newToken, err := s.newRefreshToken(user.ID, stored.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	rotated, err := s.repo.RotateRefreshToken(ctx, stored.ID, newToken)
+	if err != nil {
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	// Another request used the same token between our read and the rotation
+	if !rotated {
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			return nil, fmt.Errorf("error revoking refresh token family: %w", err)
+		}
+		return nil, errors.New("refresh token reuse detected")
+	}
+
+	if err := s.repo.TouchSession(ctx, stored.FamilyID, req.ClientIP); err != nil {
+		return nil, fmt.Errorf("error updating session: %w", err)
+	}
+
+	token, err := s.generateJWT(user, stored.FamilyID)
 	if err != nil {
 		return nil, fmt.Errorf("error generating token: %w", err)
 	}
 
-	return &models.AuthResponse{
-		Status:    "success",
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresIn: int(s.tokenDuration.Seconds()),
-	}, nil
+	return s.tokenResponse(user, token, refreshToken), nil
+}
+
+// ParseToken verifies a token signed by any key in the key set and returns its claims
+func (s *DefaultService) ParseToken(tokenString string) (jwt.MapClaims, error) {
+	return s.keys.Parse(tokenString)
+}
+
+// JWKS returns the public keys other services use to verify our tokens
+func (s *DefaultService) JWKS() models.JWKSResponse {
+	return s.keys.JWKS()
+}
+
+// ValidateAccessToken checks that a signature-valid access token has not been revoked
+func (s *DefaultService) ValidateAccessToken(ctx context.Context, userID, tokenID, sessionID string, tokenVersion int) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	// Tokens issued before the last "sign out everywhere" are no longer valid
+	if user == nil || tokenVersion < user.TokenVersion {
+		return errors.New("token has been revoked")
+	}
+
+	// Tokens issued before revocation support have no ID and are only covered by the version check
+	if tokenID == "" {
+		return nil
+	}
+
+	revoked, err := s.repo.IsAccessTokenRevoked(ctx, tokenID)
+	if err != nil {
+		return fmt.Errorf("error checking token revocation: %w", err)
+	}
+
+	if revoked {
+		return errors.New("token has been revoked")
+	}
+
+	// A device that was signed out remotely loses its access tokens too
+	if sessionID != "" {
+		revoked, err = s.repo.IsSessionRevoked(ctx, sessionID)
+		if err != nil {
+			return fmt.Errorf("error checking session revocation: %w", err)
+		}
+
+		if revoked {
+			return errors.New("token has been revoked")
+		}
+	}
+
+	return nil
+}
+
+// Logout revokes the presented access token and the refresh tokens of the same login
+func (s *DefaultService) Logout(ctx context.Context, userID, tokenID, sessionID string, expiresAt time.Time) error {
+	if tokenID != "" {
+		if err := s.repo.RevokeAccessToken(ctx, tokenID, userID, expiresAt); err != nil {
+			return fmt.Errorf("error revoking access token: %w", err)
+		}
+	}
+
+	if sessionID != "" {
+		if _, err := s.repo.RevokeSession(ctx, userID, sessionID); err != nil {
+			return fmt.Errorf("error revoking session: %w", err)
+		}
+
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+			return fmt.Errorf("error revoking refresh tokens: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// LogoutAll invalidates every access and refresh token issued to the user
+func (s *DefaultService) LogoutAll(ctx context.Context, userID string) error {
+	if err := s.repo.IncrementTokenVersion(ctx, userID); err != nil {
+		return fmt.Errorf("error incrementing token version: %w", err)
+	}
+
+	if err := s.repo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	if err := s.repo.RevokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	return nil
+}
+
+// ForgotPassword emails a password reset link if an account exists for the address.
+// Unknown addresses succeed silently so the endpoint can't be used to discover accounts.
+func (s *DefaultService) ForgotPassword(ctx context.Context, req models.ForgotPasswordRequest) error {
+	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	// Only the most recently requested link stays valid
+	if err := s.repo.InvalidateAuthTokens(ctx, user.ID, models.TokenPurposePasswordReset); err != nil {
+		return fmt.Errorf("error invalidating reset tokens: %w", err)
+	}
+
+	token, err := s.createAuthToken(ctx, user.ID, models.TokenPurposePasswordReset, "", s.passwordResetDuration)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password:\n\n%s/reset-password?token=%s\n\n"+
+				"The link expires in %s and can only be used once. If you didn't ask to reset your password, "+
+				"you can ignore this email.\n",
+			user.Name, s.publicURL, token, formatDuration(s.passwordResetDuration)),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending reset email: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func (s *DefaultService) ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error {
+	// The token is only consumed once the new password passes the policy,
+	// so the user can try another password with the same link
+	token, err := s.repo.GetAuthToken(ctx, hashToken(req.Token), models.TokenPurposePasswordReset)
+	if err != nil {
+		return fmt.Errorf("error getting reset token: %w", err)
+	}
+
+	if token == nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	if err := s.passwords.CheckPolicy(req.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	token, err = s.repo.ConsumeAuthToken(ctx, hashToken(req.Token), models.TokenPurposePasswordReset)
+	if err != nil {
+		return fmt.Errorf("error consuming reset token: %w", err)
+	}
+
+	if token == nil {
+		return errors.New("invalid or expired reset token")
+	}
+
+	hashedPassword, err := s.passwords.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	if err := s.repo.UpdateUserPassword(ctx, token.UserID, hashedPassword); err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	// Resetting the password is also how a locked-out user gets back in
+	if err := s.clearLoginFailures(ctx, user.Email); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must not stay signed in
+	return s.LogoutAll(ctx, token.UserID)
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified
+func (s *DefaultService) VerifyEmail(ctx context.Context, req models.VerifyEmailRequest) error {
+	token, err := s.repo.ConsumeAuthToken(ctx, hashToken(req.Token), models.TokenPurposeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("error consuming verification token: %w", err)
+	}
+
+	if token == nil {
+		return errors.New("invalid or expired verification token")
+	}
+
+	// The token only verifies the address it was sent to
+	verified, err := s.repo.MarkEmailVerified(ctx, token.UserID, token.Payload)
+	if err != nil {
+		return fmt.Errorf("error marking email verified: %w", err)
+	}
+
+	if !verified {
+		return errors.New("invalid or expired verification token")
+	}
+
+	return nil
+}
+
+// ResendVerification sends a new verification email to an unverified account.
+// Unknown and already verified addresses succeed silently.
+func (s *DefaultService) ResendVerification(ctx context.Context, req models.ResendVerificationRequest) error {
+	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, user)
 }
 
 // Ledger operations
@@ -122,6 +570,11 @@ func (s *DefaultService) CreateLedger(
 	userID string,
 	req models.CreateLedgerRequest,
 ) (*models.LedgerResponse, error) {
+	// Personal access tokens are scoped to existing ledgers
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot create ledgers")
+	}
+
 	// Create the ledger
 	ledger := &models.Ledger{
 		ID:          uuid.New().String(),
@@ -131,7 +584,40 @@ func (s *DefaultService) CreateLedger(
 		CreatedBy:   userID,
 	}
 
-	if err := s.repo.CreateLedger(ctx, ledger); err != nil {
+	// A template fills in the details left out and provides the first changes
+	var seed []models.LedgerChange
+	if req.TemplateID != "" {
+		template, err := s.getLedgerTemplate(ctx, userID, req.TemplateID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting ledger template: %w", err)
+		}
+
+		if template == nil {
+			return nil, errors.New("template not found")
+		}
+
+		if ledger.Description == "" {
+			ledger.Description = template.Description
+		}
+
+		if ledger.Currency == "" {
+			ledger.Currency = template.Currency
+		}
+
+		seed = seedLedgerChanges(userID, template, time.Now().UTC())
+	}
+
+	if ledger.Currency == "" {
+		return nil, errors.New("currency is required")
+	}
+
+	currency, err := normalizeCurrency(ledger.Currency)
+	if err != nil {
+		return nil, err
+	}
+	ledger.Currency = currency
+
+	if err := s.repo.CreateLedger(ctx, ledger, seed); err != nil {
 		return nil, fmt.Errorf("error creating ledger: %w", err)
 	}
 
@@ -140,32 +626,59 @@ func (s *DefaultService) CreateLedger(
 		LedgerID:              ledger.ID,
 		Name:                  ledger.Name,
 		CreatedAt:             ledger.CreatedAt.Format(time.RFC3339),
-		InitialSequenceNumber: 0, // New ledgers start with sequence 0
+		InitialSequenceNumber: int64(len(seed)), // Ledgers start after their seed changes, at 0 without a template
 	}, nil
 }
 
-func (s *DefaultService) DeleteLedger(ctx context.Context, userID, ledgerID string) error {
+// DeleteLedger moves the ledger to the trash, from which the owner can restore it until it is purged
+func (s *DefaultService) DeleteLedger(ctx context.Context, userID, ledgerID string) (*models.DeleteLedgerResponse, error) {
 	// Check if ledger exists
 	ledger, err := s.repo.GetLedger(ctx, ledgerID)
 	if err != nil {
-		return fmt.Errorf("error getting ledger: %w", err)
+		return nil, fmt.Errorf("error getting ledger: %w", err)
 	}
 
-	if ledger == nil {
-		return errors.New("ledger not found")
+	if ledger == nil || ledger.DeletedAt != nil {
+		return nil, errors.New("ledger not found")
 	}
 
 	// Check if user has permission to delete the ledger (must be the creator)
 	if ledger.CreatedBy != userID {
-		return errors.New("you don't have permission to delete this ledger")
+		return nil, errors.New("you don't have permission to delete this ledger")
 	}
 
-	// Delete the ledger
-	if err := s.repo.DeleteLedger(ctx, ledgerID); err != nil {
-		return fmt.Errorf("error deleting ledger: %w", err)
+	// A personal access token must also have write scope on the ledger
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "write")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
 	}
 
-	return nil
+	if !hasAccess {
+		return nil, errors.New("you don't have permission to delete this ledger")
+	}
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledgerID,
+		UserID:    &userID,
+		Type:      models.LedgerEventTrashed,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	trashed, err := s.repo.TrashLedger(ctx, ledgerID, event)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting ledger: %w", err)
+	}
+
+	if !trashed {
+		return nil, errors.New("ledger not found")
+	}
+
+	return &models.DeleteLedgerResponse{
+		Status:  "success",
+		Message: "Ledger moved to the trash",
+		PurgeAt: event.CreatedAt.Add(s.trashRetention),
+	}, nil
 }
 
 // Ledger changes
@@ -176,7 +689,7 @@ func (s *DefaultService) SubmitLedgerChange(
 	req models.LedgerChangeRequest,
 ) (*models.LedgerChangeResponse, error) {
 	// Check if user has write permission
-	hasAccess, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, "write")
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "write")
 	if err != nil {
 		return nil, fmt.Errorf("error checking ledger access: %w", err)
 	}
@@ -196,15 +709,22 @@ func (s *DefaultService) SubmitLedgerChange(
 	change := &models.LedgerChange{
 		ID:              uuid.New().String(),
 		LedgerID:        ledgerID,
-		UserID:          userID,
+		UserID:          &userID,
 		SQLStatement:    req.SQLStatement,
 		BaseSequenceNum: latestSeq, // Use the latest sequence as base
 		Timestamp:       time.Now().UTC(),
 		// SequenceNumber will be determined by the repository in a transaction
 	}
 
-	// Let repository handle sequence number assignment with a transaction to prevent race conditions
+	// Let repository handle sequence number assignment with a transaction to prevent race conditions.
+	// The same transaction refuses changes to archived ledgers, which are read-only.
 	if err := s.repo.AddLedgerChange(ctx, change); err != nil {
+		if errors.Is(err, repository.ErrLedgerArchived) {
+			return nil, errors.New("ledger is archived")
+		}
+		if errors.Is(err, repository.ErrLedgerTrashed) {
+			return nil, errors.New("you don't have write permission for this ledger")
+		}
 		return nil, fmt.Errorf("error adding ledger change: %w", err)
 	}
 
@@ -223,7 +743,7 @@ func (s *DefaultService) GetLedgerChanges(
 	toSeq int64,
 ) (*models.GetLedgerChangesResponse, error) {
 	// Check if user has read permission
-	hasAccess, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, "read")
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "read")
 	if err != nil {
 		return nil, fmt.Errorf("error checking ledger access: %w", err)
 	}
@@ -259,8 +779,13 @@ func (s *DefaultService) AddUserToLedger(
 	ledgerID string,
 	req models.AddUserToLedgerRequest,
 ) (*models.AddUserResponse, error) {
-	// Check if the requesting user has write permission
-	hasAccess, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, "write")
+	// Check if the requesting user has write permission, or admin permission to add an admin
+	requiredPermission := "write"
+	if req.Permissions == "admin" {
+		requiredPermission = "admin"
+	}
+
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, requiredPermission)
 	if err != nil {
 		return nil, fmt.Errorf("error checking ledger access: %w", err)
 	}
@@ -279,6 +804,29 @@ func (s *DefaultService) AddUserToLedger(
 		return nil, errors.New("user not found")
 	}
 
+	if s.requireVerifiedSharing && userToAdd.EmailVerifiedAt == nil {
+		return nil, errors.New("user has not verified their email address")
+	}
+
+	// Only owners and admins can change the permissions of another admin
+	if requiredPermission != "admin" {
+		isAdmin, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userToAdd.ID, "admin")
+		if err != nil {
+			return nil, fmt.Errorf("error checking ledger access: %w", err)
+		}
+
+		if isAdmin {
+			hasAccess, err = s.checkLedgerAccess(ctx, ledgerID, userID, "admin")
+			if err != nil {
+				return nil, fmt.Errorf("error checking ledger access: %w", err)
+			}
+
+			if !hasAccess {
+				return nil, errors.New("you don't have permission to add users to this ledger")
+			}
+		}
+	}
+
 	// Create the ledger user relationship
 	ledgerUser := &models.LedgerUser{
 		LedgerID:    ledgerID,
@@ -307,7 +855,7 @@ func (s *DefaultService) GetLatestSequenceNumber(
 	ledgerID string,
 ) (*models.SequenceNumberResponse, error) {
 	// Check if user has read permission
-	hasAccess, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, "read")
+	hasAccess, err := s.checkLedgerAccess(ctx, ledgerID, userID, "read")
 	if err != nil {
 		return nil, fmt.Errorf("error checking ledger access: %w", err)
 	}
@@ -330,15 +878,176 @@ func (s *DefaultService) GetLatestSequenceNumber(
 }
 
 // Helper methods
-func (s *DefaultService) generateJWT(user *models.User) (string, error) {
+
+// issueTokens generates an access token and a refresh token in the given family
+func (s *DefaultService) issueTokens(ctx context.Context, user *models.User, familyID string) (*models.AuthResponse, error) {
+	token, err := s.generateJWT(user, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("error generating token: %w", err)
+	}
+
+	refreshToken, stored, err := s.newRefreshToken(user.ID, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	if err := s.repo.CreateRefreshToken(ctx, stored); err != nil {
+		return nil, fmt.Errorf("error storing refresh token: %w", err)
+	}
+
+	return s.tokenResponse(user, token, refreshToken), nil
+}
+
+func (s *DefaultService) tokenResponse(user *models.User, token, refreshToken string) *models.AuthResponse {
+	return &models.AuthResponse{
+		Status:           "success",
+		UserID:           user.ID,
+		Token:            token,
+		ExpiresIn:        int(s.tokenDuration.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(s.refreshTokenDuration.Seconds()),
+	}
+}
+
+// sendVerificationEmail emails a link that verifies the user's current address
+func (s *DefaultService) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	// Only the most recently sent link stays valid
+	if err := s.repo.InvalidateAuthTokens(ctx, user.ID, models.TokenPurposeEmailVerification); err != nil {
+		return fmt.Errorf("error invalidating verification tokens: %w", err)
+	}
+
+	token, err := s.createAuthToken(ctx, user.ID, models.TokenPurposeEmailVerification, user.Email, s.verificationDuration)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s/verify-email?token=%s\n\n"+
+				"The link expires in %s.\n",
+			user.Name, s.publicURL, token, formatDuration(s.verificationDuration)),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending verification email: %w", err)
+	}
+
+	return nil
+}
+
+// createAuthToken stores a new single-use token and returns the token to send to the user
+func (s *DefaultService) createAuthToken(
+	ctx context.Context,
+	userID string,
+	purpose string,
+	payload string,
+	ttl time.Duration,
+) (string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	authToken := &models.AuthToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Payload:   payload,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	if err := s.repo.CreateAuthToken(ctx, authToken); err != nil {
+		return "", fmt.Errorf("error storing token: %w", err)
+	}
+
+	return token, nil
+}
+
+// newRefreshToken returns a random refresh token and the record to store for it
+func (s *DefaultService) newRefreshToken(userID, familyID string) (string, *models.RefreshToken, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	return token, &models.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.refreshTokenDuration),
+		CreatedAt: now,
+	}, nil
+}
+
+func (s *DefaultService) generateJWT(user *models.User, sessionID string) (string, error) {
 	expirationTime := time.Now().Add(s.tokenDuration)
 
 	claims := jwt.MapClaims{
 		"sub": user.ID, // subject
 		"exp": expirationTime.Unix(),
 		"iat": time.Now().Unix(), // issued at
+		"typ": tokenTypeAccess,
+		"jti": uuid.New().String(), // token ID, used for revocation
+		"ver": user.TokenVersion,   // invalidated by "sign out everywhere"
+		"sid": sessionID,           // refresh token family this token belongs to
+	}
+
+	return s.keys.Sign(claims)
+}
+
+// generateOpaqueToken returns a random URL-safe token with 256 bits of entropy
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// checkPassword verifies the user's password. Hashes made with an older algorithm or weaker
+// parameters are replaced while the plaintext is at hand.
+func (s *DefaultService) checkPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	ok, needsRehash, err := s.passwords.Verify(user.Password, password)
+	if err != nil {
+		return false, fmt.Errorf("error verifying password: %w", err)
+	}
+
+	if ok && needsRehash {
+		// The password was correct, so a failed upgrade shouldn't fail the request
+		hashedPassword, err := s.passwords.Hash(password)
+		if err == nil {
+			err = s.repo.UpdateUserPassword(ctx, user.ID, hashedPassword)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to upgrade password hash for user %s: %v", user.ID, err)
+		}
+	}
+
+	return ok, nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of an opaque token for storage and lookup
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatDuration renders a token lifetime for use in emails, e.g. "1 hour" or "15 minutes"
+func formatDuration(d time.Duration) string {
+	value, unit := int(d.Minutes()), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		value, unit = int(d.Hours()), "hour"
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+	if value == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", value, unit)
 }
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// startSession records the device a login comes from and issues tokens for it.
+// The session ID doubles as the refresh token family ID.
+func (s *DefaultService) startSession(ctx context.Context, user *models.User, device models.DeviceInfo) (*models.AuthResponse, error) {
+	session := &models.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		DeviceName: device.DeviceName,
+		Platform:   device.Platform,
+		AppVersion: device.AppVersion,
+		IPAddress:  device.ClientIP,
+		UserAgent:  device.UserAgent,
+	}
+
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("error creating session: %w", err)
+	}
+
+	return s.issueTokens(ctx, user, session.ID)
+}
+
+// ListSessions returns the user's signed-in devices, most recently used first
+func (s *DefaultService) ListSessions(ctx context.Context, userID, currentSessionID string) (*models.SessionsResponse, error) {
+	// Sessions idle for longer than a refresh token lives can't be resumed
+	seenSince := time.Now().UTC().Add(-s.refreshTokenDuration)
+
+	sessions, err := s.repo.ListActiveSessions(ctx, userID, seenSince)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return &models.SessionsResponse{
+		Status:   "success",
+		Sessions: sessions,
+	}, nil
+}
+
+// RevokeSession signs a device out. Its refresh tokens stop working immediately
+// and its access tokens are rejected by ValidateAccessToken.
+func (s *DefaultService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	revoked, err := s.repo.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+
+	if !revoked {
+		return errors.New("session not found")
+	}
+
+	if err := s.repo.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	return nil
+}
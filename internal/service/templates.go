@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// maxTemplateStatements is the most seed changes a template can have
+const maxTemplateStatements = 500
+
+// builtinLedgerTemplates are offered to every user. Their statements set up the app's
+// categories table.
+var builtinLedgerTemplates = []models.LedgerTemplate{
+	{
+		ID:          "household",
+		Builtin:     true,
+		Name:        "Household",
+		Description: "Shared household bills",
+		Statements: []string{
+			"INSERT INTO categories (id, name) VALUES ('rent', 'Rent')",
+			"INSERT INTO categories (id, name) VALUES ('utilities', 'Utilities')",
+			"INSERT INTO categories (id, name) VALUES ('internet', 'Internet')",
+			"INSERT INTO categories (id, name) VALUES ('groceries', 'Groceries')",
+			"INSERT INTO categories (id, name) VALUES ('supplies', 'Household Supplies')",
+		},
+	},
+	{
+		ID:          "trip",
+		Builtin:     true,
+		Name:        "Trip",
+		Description: "Shared travel expenses",
+		Statements: []string{
+			"INSERT INTO categories (id, name) VALUES ('accommodation', 'Accommodation')",
+			"INSERT INTO categories (id, name) VALUES ('transport', 'Transport')",
+			"INSERT INTO categories (id, name) VALUES ('food', 'Food & Drink')",
+			"INSERT INTO categories (id, name) VALUES ('activities', 'Activities')",
+		},
+	},
+}
+
+// ListLedgerTemplates returns the built-in templates followed by the ones the user saved
+func (s *DefaultService) ListLedgerTemplates(ctx context.Context, userID string) (*models.LedgerTemplatesResponse, error) {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot manage templates")
+	}
+
+	saved, err := s.repo.GetLedgerTemplates(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger templates: %w", err)
+	}
+
+	templates := append([]models.LedgerTemplate{}, builtinLedgerTemplates...)
+	templates = append(templates, saved...)
+
+	return &models.LedgerTemplatesResponse{
+		Status:    "success",
+		Templates: templates,
+	}, nil
+}
+
+// SaveLedgerTemplate saves a template for the user. Its statements are either given in the
+// request or copied from the changes of a ledger the user can read, whose description and
+// currency then serve as defaults too.
+func (s *DefaultService) SaveLedgerTemplate(
+	ctx context.Context,
+	userID string,
+	req models.SaveLedgerTemplateRequest,
+) (*models.LedgerTemplateResponse, error) {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot manage templates")
+	}
+
+	now := time.Now().UTC()
+	template := &models.LedgerTemplate{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+		Currency:    req.Currency,
+		Statements:  append([]string{}, req.Statements...),
+		CreatedAt:   &now,
+	}
+
+	if req.LedgerID != "" {
+		hasAccess, err := s.checkLedgerAccess(ctx, req.LedgerID, userID, "read")
+		if err != nil {
+			return nil, fmt.Errorf("error checking ledger access: %w", err)
+		}
+
+		if !hasAccess {
+			return nil, errors.New("you don't have access to this ledger")
+		}
+
+		ledger, err := s.repo.GetLedger(ctx, req.LedgerID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting ledger: %w", err)
+		}
+
+		if ledger == nil {
+			return nil, errors.New("ledger not found")
+		}
+
+		changes, err := s.repo.GetLedgerChangesBySequenceRange(ctx, req.LedgerID, 1, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error getting ledger changes: %w", err)
+		}
+
+		if len(changes) > maxTemplateStatements {
+			return nil, errors.New("ledger has too many changes for a template")
+		}
+
+		for _, change := range changes {
+			template.Statements = append(template.Statements, change.SQLStatement)
+		}
+
+		if template.Description == "" {
+			template.Description = ledger.Description
+		}
+
+		if template.Currency == "" {
+			template.Currency = ledger.Currency
+		}
+	}
+
+	// Templates without a currency leave it to the ledgers made from them
+	if template.Currency != "" {
+		currency, err := normalizeCurrency(template.Currency)
+		if err != nil {
+			return nil, err
+		}
+		template.Currency = currency
+	}
+
+	if err := s.repo.CreateLedgerTemplate(ctx, template); err != nil {
+		return nil, fmt.Errorf("error saving ledger template: %w", err)
+	}
+
+	return &models.LedgerTemplateResponse{
+		Status:   "success",
+		Template: *template,
+	}, nil
+}
+
+// DeleteLedgerTemplate deletes one of the user's saved templates. Ledgers made from it are unaffected.
+func (s *DefaultService) DeleteLedgerTemplate(ctx context.Context, userID, templateID string) error {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return errors.New("personal access tokens cannot manage templates")
+	}
+
+	for _, template := range builtinLedgerTemplates {
+		if template.ID == templateID {
+			return errors.New("built-in templates cannot be deleted")
+		}
+	}
+
+	deleted, err := s.repo.DeleteLedgerTemplate(ctx, userID, templateID)
+	if err != nil {
+		return fmt.Errorf("error deleting ledger template: %w", err)
+	}
+
+	if !deleted {
+		return errors.New("template not found")
+	}
+
+	return nil
+}
+
+// getLedgerTemplate returns the built-in template or one of the user's saved templates
+// with the ID, or nil if there is none
+func (s *DefaultService) getLedgerTemplate(ctx context.Context, userID, templateID string) (*models.LedgerTemplate, error) {
+	for i, template := range builtinLedgerTemplates {
+		if template.ID == templateID {
+			return &builtinLedgerTemplates[i], nil
+		}
+	}
+
+	// Saved template IDs are UUIDs, so anything else can't match one
+	if _, err := uuid.Parse(templateID); err != nil {
+		return nil, nil
+	}
+
+	template, err := s.repo.GetLedgerTemplate(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Other users' templates are private
+	if template == nil || template.UserID != userID {
+		return nil, nil
+	}
+
+	return template, nil
+}
+
+// seedLedgerChanges turns the template's statements into the first changes of a new ledger,
+// each based on the one before it
+func seedLedgerChanges(userID string, template *models.LedgerTemplate, timestamp time.Time) []models.LedgerChange {
+	changes := make([]models.LedgerChange, len(template.Statements))
+	for i, statement := range template.Statements {
+		changes[i] = models.LedgerChange{
+			ID:              uuid.New().String(),
+			UserID:          &userID,
+			SequenceNumber:  int64(i + 1),
+			SQLStatement:    statement,
+			Timestamp:       timestamp,
+			BaseSequenceNum: int64(i),
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LoginThrottledError is returned when an account or IP address is temporarily locked
+// after too many failed logins, or an address has been sent too many sign-in links
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many login attempts"
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func magicLinkRateLimitKey(email string) string {
+	return "magic-link:" + strings.ToLower(email)
+}
+
+// checkLoginThrottle returns a LoginThrottledError if the account or the IP address is locked
+func (s *DefaultService) checkLoginThrottle(ctx context.Context, email, ip string) error {
+	keys := []string{accountThrottleKey(email)}
+	if ip != "" {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+
+	now := time.Now().UTC()
+	var retryAfter time.Duration
+
+	for _, key := range keys {
+		throttle, err := s.repo.GetLoginThrottle(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error getting login throttle: %w", err)
+		}
+
+		if throttle != nil && throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			if wait := throttle.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt against the account and the IP address,
+// locking either one once it exceeds its limit
+func (s *DefaultService) recordLoginFailure(ctx context.Context, email, ip string) error {
+	if err := s.recordThrottleFailure(ctx, accountThrottleKey(email), s.throttle.MaxAccountFailures); err != nil {
+		return err
+	}
+
+	if ip != "" {
+		return s.recordThrottleFailure(ctx, ipThrottleKey(ip), s.throttle.MaxIPFailures)
+	}
+
+	return nil
+}
+
+func (s *DefaultService) recordThrottleFailure(ctx context.Context, key string, maxFailures int) error {
+	now := time.Now().UTC()
+
+	failures, err := s.repo.RecordLoginFailure(ctx, key, now.Add(-s.throttle.FailureWindow))
+	if err != nil {
+		return fmt.Errorf("error recording login failure: %w", err)
+	}
+
+	if failures < maxFailures {
+		return nil
+	}
+
+	if err := s.repo.LockLoginThrottle(ctx, key, now.Add(s.lockoutDuration(failures-maxFailures))); err != nil {
+		return fmt.Errorf("error locking login: %w", err)
+	}
+
+	return nil
+}
+
+// lockoutDuration doubles the base lockout for every failure past the limit, up to the maximum
+func (s *DefaultService) lockoutDuration(excessFailures int) time.Duration {
+	lockout := s.throttle.LockoutBase
+	for i := 0; i < excessFailures && lockout < s.throttle.LockoutMax; i++ {
+		lockout *= 2
+	}
+
+	if lockout > s.throttle.LockoutMax {
+		return s.throttle.LockoutMax
+	}
+	return lockout
+}
+
+// clearLoginFailures resets the account counter after a complete, successful login.
+// The IP counter is left alone so one valid account can't be used to reset it.
+func (s *DefaultService) clearLoginFailures(ctx context.Context, email string) error {
+	if err := s.repo.ClearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return fmt.Errorf("error clearing login throttle: %w", err)
+	}
+	return nil
+}
+
+// checkRateLimit counts a request against the key and returns a LoginThrottledError
+// once more than limit requests were made in the current window
+func (s *DefaultService) checkRateLimit(ctx context.Context, key string, limit int, window time.Duration) error {
+	now := time.Now().UTC()
+
+	rateLimit, err := s.repo.HitRateLimit(ctx, key, now.Add(-window))
+	if err != nil {
+		return fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	if rateLimit.Hits > limit {
+		return &LoginThrottledError{RetryAfter: rateLimit.WindowStart.Add(window).Sub(now)}
+	}
+
+	return nil
+}
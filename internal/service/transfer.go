@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// ProposeLedgerTransfer offers ownership of the ledger to another member. Nothing changes until
+// they accept, and a new proposal replaces the pending one.
+func (s *DefaultService) ProposeLedgerTransfer(
+	ctx context.Context,
+	userID string,
+	ledgerID string,
+	req models.TransferLedgerRequest,
+) (*models.LedgerTransferResponse, error) {
+	// Handing over a ledger is left to the owner themselves
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot transfer ledgers")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if ledger == nil || ledger.DeletedAt != nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	if ledger.CreatedBy != userID {
+		return nil, errors.New("only the owner can transfer this ledger")
+	}
+
+	target, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if target != nil && target.ID == userID {
+		return nil, errors.New("you already own this ledger")
+	}
+
+	// The new owner must already be a member
+	isMember := false
+	if target != nil {
+		isMember, err = s.repo.CheckLedgerAccess(ctx, ledgerID, target.ID, "read")
+		if err != nil {
+			return nil, fmt.Errorf("error checking ledger access: %w", err)
+		}
+	}
+
+	if !isMember {
+		return nil, errors.New("user is not a member of this ledger")
+	}
+
+	now := time.Now().UTC()
+	transfer := &models.LedgerTransfer{
+		LedgerID:   ledgerID,
+		FromUserID: userID,
+		ToUserID:   target.ID,
+		ExpiresAt:  now.Add(s.transferTTL),
+		CreatedAt:  now,
+	}
+
+	if err := s.repo.SaveLedgerTransfer(ctx, transfer); err != nil {
+		return nil, fmt.Errorf("error saving ledger transfer: %w", err)
+	}
+
+	return &models.LedgerTransferResponse{
+		Status:   "success",
+		Message:  "Ownership transfer proposed",
+		Transfer: *transfer,
+	}, nil
+}
+
+// AcceptLedgerTransfer makes the user the owner of the ledger if its owner proposed it to them
+func (s *DefaultService) AcceptLedgerTransfer(ctx context.Context, userID, ledgerID string) (*models.UpdateLedgerResponse, error) {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot transfer ledgers")
+	}
+
+	transfer, err := s.repo.GetLedgerTransfer(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger transfer: %w", err)
+	}
+
+	if transfer == nil || transfer.ToUserID != userID {
+		return nil, errors.New("no ownership transfer is pending")
+	}
+
+	// Postgres keeps microseconds, so the ledger's ETag matches the stored value
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !transfer.ExpiresAt.After(now) {
+		return nil, errors.New("the ownership transfer has expired")
+	}
+
+	// Members who have since been removed, or of a ledger now in the trash, can't take it over
+	isMember, err := s.repo.CheckLedgerAccess(ctx, ledgerID, userID, "read")
+	if err != nil {
+		return nil, fmt.Errorf("error checking ledger access: %w", err)
+	}
+
+	if !isMember {
+		return nil, errors.New("no ownership transfer is pending")
+	}
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledgerID,
+		UserID:    &userID,
+		Type:      models.LedgerEventOwnerChanged,
+		Details:   models.LedgerEventDetails{"from": transfer.FromUserID, "to": transfer.ToUserID},
+		CreatedAt: now,
+	}
+
+	completed, err := s.repo.CompleteLedgerTransfer(ctx, transfer, event)
+	if err != nil {
+		return nil, fmt.Errorf("error completing ledger transfer: %w", err)
+	}
+
+	if !completed {
+		return nil, errors.New("no ownership transfer is pending")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	if ledger == nil {
+		return nil, errors.New("ledger not found")
+	}
+
+	return &models.UpdateLedgerResponse{Status: "success", Ledger: *ledger}, nil
+}
+
+// CancelLedgerTransfer withdraws the pending transfer. The owner can cancel it and its
+// recipient can decline it.
+func (s *DefaultService) CancelLedgerTransfer(ctx context.Context, userID, ledgerID string) error {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return errors.New("personal access tokens cannot transfer ledgers")
+	}
+
+	transfer, err := s.repo.GetLedgerTransfer(ctx, ledgerID)
+	if err != nil {
+		return fmt.Errorf("error getting ledger transfer: %w", err)
+	}
+
+	if transfer == nil || (transfer.FromUserID != userID && transfer.ToUserID != userID) {
+		return errors.New("no ownership transfer is pending")
+	}
+
+	if err := s.repo.DeleteLedgerTransfer(ctx, ledgerID); err != nil {
+		return fmt.Errorf("error deleting ledger transfer: %w", err)
+	}
+
+	return nil
+}
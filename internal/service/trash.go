@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rongwang/COMP90018-server/internal/models"
+)
+
+// ListTrashedLedgers returns the user's deleted ledgers that can still be restored
+func (s *DefaultService) ListTrashedLedgers(ctx context.Context, userID string) (*models.TrashedLedgersResponse, error) {
+	// Personal access tokens are scoped to live ledgers
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot manage the trash")
+	}
+
+	ledgers, err := s.repo.GetTrashedLedgers(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting trashed ledgers: %w", err)
+	}
+
+	// Expired ledgers are left out until the purger gets to them
+	cutoff := time.Now().UTC().Add(-s.trashRetention)
+	res := &models.TrashedLedgersResponse{
+		Status:  "success",
+		Ledgers: []models.TrashedLedger{},
+	}
+
+	for _, ledger := range ledgers {
+		if !ledger.DeletedAt.After(cutoff) {
+			continue
+		}
+
+		res.Ledgers = append(res.Ledgers, models.TrashedLedger{
+			Ledger:  ledger,
+			PurgeAt: ledger.DeletedAt.Add(s.trashRetention),
+		})
+	}
+
+	return res, nil
+}
+
+// RestoreLedger takes one of the user's ledgers out of the trash, giving its members access again
+func (s *DefaultService) RestoreLedger(ctx context.Context, userID, ledgerID string) (*models.RestoreLedgerResponse, error) {
+	if personalAccessTokenFromContext(ctx) != nil {
+		return nil, errors.New("personal access tokens cannot manage the trash")
+	}
+
+	ledger, err := s.repo.GetLedger(ctx, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ledger: %w", err)
+	}
+
+	// Only the owner can see their trash
+	if ledger == nil || ledger.CreatedBy != userID {
+		return nil, errors.New("ledger not found")
+	}
+
+	if ledger.DeletedAt == nil {
+		return nil, errors.New("ledger is not in the trash")
+	}
+
+	event := &models.LedgerEvent{
+		ID:        uuid.New().String(),
+		LedgerID:  ledgerID,
+		UserID:    &userID,
+		Type:      models.LedgerEventRestored,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	restored, err := s.repo.RestoreLedger(ctx, ledgerID, event.CreatedAt.Add(-s.trashRetention), event)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring ledger: %w", err)
+	}
+
+	if !restored {
+		return nil, errors.New("the ledger's retention period has expired")
+	}
+
+	ledger.DeletedAt = nil
+
+	return &models.RestoreLedgerResponse{
+		Status:  "success",
+		Message: "Ledger restored",
+		Ledger:  *ledger,
+	}, nil
+}
+
+// PurgeTrashedLedgers permanently deletes the ledgers whose retention period has expired
+func (s *DefaultService) PurgeTrashedLedgers(ctx context.Context) (int64, error) {
+	purged, err := s.repo.PurgeTrashedLedgers(ctx, time.Now().UTC().Add(-s.trashRetention))
+	if err != nil {
+		return 0, fmt.Errorf("error purging trashed ledgers: %w", err)
+	}
+
+	return purged, nil
+}
+
+// RunLedgerPurger purges expired ledgers from the trash now and then every interval,
+// until ctx is cancelled. It does nothing if interval is 0.
+func RunLedgerPurger(ctx context.Context, svc Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := svc.PurgeTrashedLedgers(ctx)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d ledger(s) from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
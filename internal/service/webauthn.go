@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rongwang/COMP90018-server/internal/models"
+	"github.com/rongwang/COMP90018-server/internal/webauthn"
+)
+
+// StartWebAuthnRegistration returns the options for creating a passkey for the signed-in user
+func (s *DefaultService) StartWebAuthnRegistration(ctx context.Context, userID string) (*models.WebAuthnRegistrationStartResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing passkeys: %w", err)
+	}
+
+	challenge, err := s.createWebAuthnChallenge(ctx, models.WebAuthnCeremonyRegistration, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]models.WebAuthnCredentialParameter, 0, len(webauthn.Algorithms))
+	for _, alg := range webauthn.Algorithms {
+		params = append(params, models.WebAuthnCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	// Stops the user from registering the same authenticator twice
+	exclude := make([]models.WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		exclude = append(exclude, models.WebAuthnCredentialDescriptor{Type: "public-key", ID: credential.CredentialID})
+	}
+
+	return &models.WebAuthnRegistrationStartResponse{
+		Status: "success",
+		PublicKey: models.WebAuthnRegistrationOptions{
+			Challenge: challenge,
+			RP: models.WebAuthnRelyingParty{
+				ID:   s.webauthn.ID,
+				Name: s.webauthn.Name,
+			},
+			User: models.WebAuthnUser{
+				ID:          base64.RawURLEncoding.EncodeToString([]byte(user.ID)),
+				Name:        user.Email,
+				DisplayName: user.Name,
+			},
+			PubKeyCredParams:   params,
+			Timeout:            s.webauthnTimeout.Milliseconds(),
+			ExcludeCredentials: exclude,
+			AuthenticatorSelection: models.WebAuthnAuthenticatorSelection{
+				// Passkeys must be discoverable, since login doesn't ask for the email address
+				ResidentKey:      "required",
+				UserVerification: "preferred",
+			},
+			Attestation: "none",
+		},
+	}, nil
+}
+
+// FinishWebAuthnRegistration verifies the new credential and stores it as a passkey of the user
+func (s *DefaultService) FinishWebAuthnRegistration(
+	ctx context.Context,
+	userID string,
+	req models.FinishWebAuthnRegistrationRequest,
+) (*models.WebAuthnCredentialResponse, error) {
+	clientDataJSON, err := webauthn.DecodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("invalid passkey registration")
+	}
+
+	attestationObject, err := webauthn.DecodeBase64URL(req.Credential.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid passkey registration")
+	}
+
+	challenge, err := s.consumeWebAuthnChallenge(ctx, clientDataJSON, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	// A challenge is only good for the user who started the registration
+	if challenge.UserID == nil || *challenge.UserID != userID {
+		return nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	credential, err := s.webauthn.VerifyRegistration(challenge.value, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Printf("Warning: rejected passkey registration for user %s: %v", userID, err)
+		return nil, errors.New("invalid passkey registration")
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	existing, err := s.repo.GetWebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting passkey: %w", err)
+	}
+
+	if existing != nil {
+		return nil, errors.New("passkey already registered")
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	stored := &models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Name:         name,
+	}
+
+	if err := s.repo.CreateWebAuthnCredential(ctx, stored); err != nil {
+		return nil, fmt.Errorf("error storing passkey: %w", err)
+	}
+
+	return &models.WebAuthnCredentialResponse{
+		Status:     "success",
+		Credential: *stored,
+	}, nil
+}
+
+// StartWebAuthnLogin returns the options for signing in with any passkey for this server
+func (s *DefaultService) StartWebAuthnLogin(ctx context.Context) (*models.WebAuthnLoginStartResponse, error) {
+	challenge, err := s.createWebAuthnChallenge(ctx, models.WebAuthnCeremonyLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnLoginStartResponse{
+		Status: "success",
+		PublicKey: models.WebAuthnLoginOptions{
+			Challenge:        challenge,
+			RPID:             s.webauthn.ID,
+			Timeout:          s.webauthnTimeout.Milliseconds(),
+			AllowCredentials: []models.WebAuthnCredentialDescriptor{},
+			UserVerification: "preferred",
+		},
+	}, nil
+}
+
+// FinishWebAuthnLogin verifies a passkey assertion and signs its owner in. Passkeys that
+// verified the user (biometrics or a PIN) are already two factors; otherwise accounts with
+// two-factor authentication still get a challenge.
+func (s *DefaultService) FinishWebAuthnLogin(ctx context.Context, req models.FinishWebAuthnLoginRequest) (*models.AuthResponse, error) {
+	clientDataJSON, errC := webauthn.DecodeBase64URL(req.Credential.Response.ClientDataJSON)
+	authenticatorData, errA := webauthn.DecodeBase64URL(req.Credential.Response.AuthenticatorData)
+	signature, errS := webauthn.DecodeBase64URL(req.Credential.Response.Signature)
+	if errC != nil || errA != nil || errS != nil {
+		return nil, errors.New("invalid passkey")
+	}
+
+	challenge, err := s.consumeWebAuthnChallenge(ctx, clientDataJSON, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.repo.GetWebAuthnCredential(ctx, req.Credential.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting passkey: %w", err)
+	}
+
+	if credential == nil {
+		return nil, errors.New("invalid passkey")
+	}
+
+	// The user handle is optional, but if the authenticator sends one it must match
+	if req.Credential.Response.UserHandle != "" {
+		userHandle, err := webauthn.DecodeBase64URL(req.Credential.Response.UserHandle)
+		if err != nil || string(userHandle) != credential.UserID {
+			return nil, errors.New("invalid passkey")
+		}
+	}
+
+	assertion, err := s.webauthn.VerifyAssertion(
+		challenge.value, credential.PublicKey, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		log.Printf("Warning: rejected passkey login for credential %s: %v", credential.ID, err)
+		return nil, errors.New("invalid passkey")
+	}
+
+	counted, err := s.repo.UpdateWebAuthnSignCount(ctx, credential.ID, int64(assertion.SignCount))
+	if err != nil {
+		return nil, fmt.Errorf("error updating passkey: %w", err)
+	}
+
+	if !counted {
+		log.Printf("Warning: sign count of passkey %s went from %d to %d; it may have been cloned",
+			credential.ID, credential.SignCount, assertion.SignCount)
+		return nil, errors.New("passkey sign count did not increase")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, credential.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	if user == nil {
+		return nil, errors.New("invalid passkey")
+	}
+
+	if s.requireVerifiedLogin && user.EmailVerifiedAt == nil {
+		return nil, errors.New("email address not verified")
+	}
+
+	if !assertion.UserVerified {
+		mfa, err := s.repo.GetUserMFA(ctx, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+		}
+
+		if mfa != nil && mfa.ConfirmedAt != nil {
+			return s.mfaChallenge(user)
+		}
+	}
+
+	if err := s.clearLoginFailures(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user, req.DeviceInfo)
+}
+
+// ListWebAuthnCredentials returns the user's passkeys
+func (s *DefaultService) ListWebAuthnCredentials(ctx context.Context, userID string) (*models.WebAuthnCredentialsResponse, error) {
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing passkeys: %w", err)
+	}
+
+	return &models.WebAuthnCredentialsResponse{
+		Status:      "success",
+		Credentials: credentials,
+	}, nil
+}
+
+// DeleteWebAuthnCredential removes one of the user's passkeys
+func (s *DefaultService) DeleteWebAuthnCredential(ctx context.Context, userID, credentialID string) error {
+	deleted, err := s.repo.DeleteWebAuthnCredential(ctx, userID, credentialID)
+	if err != nil {
+		return fmt.Errorf("error deleting passkey: %w", err)
+	}
+
+	if !deleted {
+		return errors.New("passkey not found")
+	}
+
+	return nil
+}
+
+// webauthnChallenge is a consumed challenge together with its plaintext value
+type webauthnChallenge struct {
+	*models.WebAuthnChallenge
+	value string
+}
+
+// createWebAuthnChallenge stores a new challenge for a ceremony and returns it base64url-encoded
+func (s *DefaultService) createWebAuthnChallenge(ctx context.Context, ceremony string, userID *string) (string, error) {
+	challenge, err := generateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating challenge: %w", err)
+	}
+
+	err = s.repo.CreateWebAuthnChallenge(ctx, &models.WebAuthnChallenge{
+		ChallengeHash: hashToken(challenge),
+		Ceremony:      ceremony,
+		UserID:        userID,
+		ExpiresAt:     time.Now().UTC().Add(s.webauthnTimeout),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge finds the ceremony a response belongs to by the challenge in its client data
+func (s *DefaultService) consumeWebAuthnChallenge(ctx context.Context, clientDataJSON []byte, ceremony string) (*webauthnChallenge, error) {
+	value, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	challenge, err := s.repo.ConsumeWebAuthnChallenge(ctx, hashToken(value), ceremony)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming challenge: %w", err)
+	}
+
+	if challenge == nil {
+		return nil, errors.New("invalid or expired passkey challenge")
+	}
+
+	return &webauthnChallenge{WebAuthnChallenge: challenge, value: value}, nil
+}
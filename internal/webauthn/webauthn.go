@@ -0,0 +1,238 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rongwang/COMP90018-server/internal/config"
+)
+
+// Ceremony types found in client data
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// RelyingParty verifies registration and login ceremonies for one relying party ID.
+// Attestation statements are not verified: registrations ask for "none" attestation,
+// and any statement an authenticator sends anyway is ignored.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	rpIDSum [32]byte
+	origins map[string]bool
+}
+
+// Credential is a public key credential created by a registration ceremony
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key encoding
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the result of a verified login ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// NewRelyingParty creates a RelyingParty from the configuration
+func NewRelyingParty(cfg config.WebAuthnConfig) *RelyingParty {
+	origins := make(map[string]bool)
+	for _, origin := range cfg.Origins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins[origin] = true
+		}
+	}
+
+	return &RelyingParty{
+		ID:      cfg.RPID,
+		Name:    cfg.RPName,
+		rpIDSum: sha256.Sum256([]byte(cfg.RPID)),
+		origins: origins,
+	}
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Challenge returns the challenge a client signed, so the server can find the ceremony
+// the response belongs to. The rest of the client data is checked by the Verify methods.
+func Challenge(clientDataJSON []byte) (string, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return "", fmt.Errorf("invalid client data: %w", err)
+	}
+
+	if data.Challenge == "" {
+		return "", errors.New("client data has no challenge")
+	}
+
+	return data.Challenge, nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create() and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+
+	attestation, ok := v.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("invalid attestation object")
+	}
+
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	flags, signCount, attested, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags&flagAttestedCredData == 0 {
+		return nil, errors.New("authenticator data has no credential")
+	}
+
+	// Attested credential data: AAGUID (16 bytes), credential ID length (2 bytes),
+	// credential ID, then the COSE_Key, optionally followed by extensions
+	if len(attested) < 18 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	idLength := int(binary.BigEndian.Uint16(attested[16:18]))
+	attested = attested[18:]
+	if idLength == 0 || idLength > 1023 || len(attested) < idLength {
+		return nil, errors.New("invalid credential ID")
+	}
+
+	credentialID := append([]byte(nil), attested[:idLength]...)
+	attested = attested[idLength:]
+
+	_, extensions, err := decodePublicKey(attested)
+	if err != nil {
+		return nil, err
+	}
+
+	if (flags&flagExtensionData == 0) != (len(extensions) == 0) {
+		return nil, errors.New("unexpected data after public key")
+	}
+
+	return &Credential{
+		ID:           credentialID,
+		PublicKey:    append([]byte(nil), attested[:len(attested)-len(extensions)]...),
+		SignCount:    signCount,
+		UserVerified: flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get() against the
+// credential's public key. Comparing sign counts is left to the caller, which knows the stored one.
+func (rp *RelyingParty) VerifyAssertion(
+	challenge string,
+	publicKey []byte,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	flags, signCount, _, err := rp.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the authenticator data followed by the hash of the client data
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, errors.New("invalid signature")
+	}
+
+	return &Assertion{
+		SignCount:    signCount,
+		UserVerified: flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("invalid client data: %w", err)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected client data type %q", data.Type)
+	}
+
+	if data.Challenge != challenge {
+		return errors.New("challenge mismatch")
+	}
+
+	if !rp.origins[data.Origin] {
+		return fmt.Errorf("origin %q is not allowed", data.Origin)
+	}
+
+	if data.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData checks the relying party ID hash and user presence, and returns
+// the flags, the signature counter and whatever follows the fixed 37-byte header
+func (rp *RelyingParty) parseAuthenticatorData(authData []byte) (byte, uint32, []byte, error) {
+	if len(authData) < 37 {
+		return 0, 0, nil, errors.New("authenticator data is too short")
+	}
+
+	if !bytes.Equal(authData[:32], rp.rpIDSum[:]) {
+		return 0, 0, nil, errors.New("relying party ID mismatch")
+	}
+
+	flags := authData[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, nil, errors.New("user was not present")
+	}
+
+	return flags, binary.BigEndian.Uint32(authData[33:37]), authData[37:], nil
+}
+
+// DecodeBase64URL decodes the base64url values WebAuthn clients send, with or without padding
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -18,7 +18,7 @@ go get -t -v github.com/gin-gonic/gin
 # Create test database if it doesn't exist
 echo -e "Setting up test database..."
 PGPASSWORD=password psql -h localhost -U postgres -c "CREATE DATABASE billapp_test;" || true
-PGPASSWORD=password psql -h localhost -U postgres -d billapp_test -c "DROP TABLE IF EXISTS ledger_changes, ledger_users, ledgers, users CASCADE;"
+PGPASSWORD=password psql -h localhost -U postgres -d billapp_test -c "DROP TABLE IF EXISTS ledger_templates, ledger_transfers, ledger_events, webauthn_challenges, webauthn_credentials, rate_limits, sessions, personal_access_token_ledgers, personal_access_tokens, user_identities, oidc_states, login_throttles, mfa_recovery_codes, user_mfa, auth_tokens, revoked_tokens, refresh_tokens, ledger_changes, ledger_users, ledgers, users CASCADE;"
 
 # Run the database initialization script on test DB
 PGPASSWORD=password psql -h localhost -U postgres -d billapp_test -f scripts/db_init_test.sql
@@ -27,7 +27,32 @@ PGPASSWORD=password psql -h localhost -U postgres -d billapp_test -f scripts/db_
 echo -e "${GREEN}Running tests...${NC}"
 # Run tests individually to avoid package conflicts
 go test -v ./internal/api/tests/auth_test.go
+go test -v ./internal/api/tests/auth_refresh_test.go
+go test -v ./internal/api/tests/auth_logout_test.go
+go test -v ./internal/api/tests/password_reset_test.go
+go test -v ./internal/api/tests/email_verification_test.go
+go test -v ./internal/api/tests/mfa_test.go
+go test -v ./internal/api/tests/login_throttle_test.go
+go test -v ./internal/api/tests/password_hash_test.go
+go test -v ./internal/api/tests/password_policy_test.go
+go test -v ./internal/api/tests/magic_link_test.go
+go test -v ./internal/api/tests/webauthn_test.go
+go test -v ./internal/api/tests/jwks_test.go
+go test -v ./internal/api/tests/oidc_test.go
+go test -v ./internal/api/tests/personal_access_token_test.go
+go test -v ./internal/api/tests/session_test.go
+go test -v ./internal/api/tests/profile_test.go
+go test -v ./internal/api/tests/account_test.go
 go test -v ./internal/api/tests/ledger_test.go
+go test -v ./internal/api/tests/ledger_list_test.go
+go test -v ./internal/api/tests/ledger_details_test.go
+go test -v ./internal/api/tests/ledger_update_test.go
+go test -v ./internal/api/tests/ledger_trash_test.go
+go test -v ./internal/api/tests/ledger_archive_test.go
+go test -v ./internal/api/tests/ledger_transfer_test.go
+go test -v ./internal/api/tests/ledger_fork_test.go
+go test -v ./internal/api/tests/ledger_templates_test.go
+go test -v ./internal/api/tests/currency_test.go
 go test -v ./internal/api/tests/ledger_changes_test.go
 go test -v ./internal/api/tests/ledger_sharing_test.go
 go test -v ./internal/api/tests/ledger_concurrent_test.go